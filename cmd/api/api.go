@@ -4,23 +4,38 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/config"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/credential"
 	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/persistence"
 	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/script"
 	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows"
 	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/kubevirt"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
+	"github.com/indeedeng/iwf-golang-sdk/gen/iwfidl"
 	"github.com/indeedeng/iwf-golang-sdk/iwf"
 	"github.com/urfave/cli"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
 )
 
 const providerKubevirt = "kubevirt"
 
-var client = iwf.NewClient(workflows.GetRegistry(), nil)
+var client iwf.Client
+
+var credStore credential.Store
+
+// runnerImages resolves the capi-runner image shown by dry runs
+var runnerImages common.RunnerImages
+
+var provisionLimits = common.DefaultProvisionLimits()
 
 func BuildCApiCLI() *cli.App {
 	app := cli.NewApp()
@@ -32,18 +47,72 @@ func BuildCApiCLI() *cli.App {
 			Name:   "serve",
 			Usage:  "Start API server",
 			Action: StartAPIServer,
+			Flags:  config.Flags(),
+		},
+		{
+			Name:   "render",
+			Usage:  "Print the script, Job and namespace a provision request would create, without creating them",
+			Action: RenderProvisionCommand,
+			Flags: append(config.Flags(),
+				cli.StringFlag{
+					Name:  "file, f",
+					Usage: "path of the ClusterProvisionConfig as JSON or YAML, - reads stdin",
+				},
+			),
 		},
 	}
 	return app
 }
 
 func StartAPIServer(c *cli.Context) {
+	cfg, err := config.Load(c, config.ComponentAPI)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	script.SetCatalog(script.NewCatalog(cfg.TemplateDir))
+	runnerImages = cfg.RunnerImages
+	provisionLimits = cfg.Provision
+
+	// the API only starts and signals workflows, it never runs their states
+	registry, err := workflows.NewRegistry(workflows.Options{})
+	if err != nil {
+		log.Fatalf("Failed to register workflows: %v", err)
+	}
+	client, err = cfg.IWF.NewClient(registry)
+	if err != nil {
+		log.Fatalf("Failed to configure iWF client: %v", err)
+	}
+
+	store, err := credential.NewStore(cfg.Credentials.Store, cfg.Credentials.File)
+	if err != nil {
+		log.Fatalf("Failed to set up credential store: %v", err)
+	}
+	credStore = store
+
+	historyStore, err := persistence.NewStore(cfg.History.StoreOptions())
+	if err != nil {
+		log.Fatalf("Failed to set up history store: %v", err)
+	}
+	persistence.SetStore(historyStore)
+
 	r := gin.Default()
 
 	r.POST("/api/v1/clouds/:owner/:provider/cluster", ProvisionClusterHandler)
+	r.DELETE("/api/v1/clouds/:owner/:provider/cluster/:name", DeleteClusterHandler)
+	r.PATCH("/api/v1/clouds/:owner/:provider/cluster/:name/pools/:pool", ScaleWorkerPoolHandler)
+	r.POST("/api/v1/clouds/:owner/:provider/cluster/:name/upgrade", UpgradeClusterHandler)
+	r.GET("/api/v1/clouds/:owner/:provider/cluster/:name/kubeconfig", GetClusterKubeconfigHandler)
+	r.POST("/api/v1/clouds/:owner/:provider/cluster/:name/kubeconfig/rotate", RotateClusterKubeconfigHandler)
+	r.GET("/api/v1/templates", ListTemplatesHandler)
+	r.GET("/workflow/:id", GetWorkflowStatusHandler)
 	r.GET("/workflow/:id/history", GetWorkflowHistoryHandler)
-	log.Println("API server running on :8080")
-	if err := r.Run(":8080"); err != nil {
+	r.GET("/workflow/:id/logs", GetWorkflowLogsHandler)
+	r.POST("/workflow/:id/pause", UpgradeSignalHandler(kubevirt.PauseUpgradeSignal))
+	r.POST("/workflow/:id/resume", UpgradeSignalHandler(kubevirt.ResumeUpgradeSignal))
+	r.POST("/workflow/:id/cancel", CancelWorkflowHandler)
+	r.POST("/workflow/:id/retry", RetryWorkflowHandler)
+	log.Printf("API server running on %s", cfg.API.ListenAddress)
+	if err := cfg.API.ListenAndServe(cfg.API.NewServer(r)); err != nil {
 		log.Fatalf("Failed to start API server: %v", err)
 	}
 }
@@ -59,26 +128,134 @@ func ProvisionClusterHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	params.Default(provisionLimits)
+	if errs := params.Validate(provisionLimits); len(errs) > 0 {
+		writeFieldErrors(c, errs)
+		return
+	}
+
+	// a dry run redacts the admin kubeconfig, so it needs no credential and answers before one is resolved
+	if dryRun, _ := strconv.ParseBool(c.Query("dryRun")); dryRun {
+		preview, err := service.PreviewCreate(newKubevirtCreateOperation(&common.CredentialSpec{}, params), runnerImages)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, preview)
+		return
+	}
 
-	var cred *common.CredentialSpec
+	cred, ok := resolveCredential(c, params.ImportOptions.Provider.Credential, cloudProvider)
+	if !ok {
+		return
+	}
 
-	providerOpts, err := ProvisionCAPICluster(c.Request.Context(), cred, params, cloudProvider)
-	if err != nil {
+	ownerID, _ := ownerIDParam(c)
+	resp, err := ProvisionCAPICluster(c.Request.Context(), cred, params, cloudProvider, ownerID, c.GetHeader(idempotencyKeyHeader))
+	var exists *clusterExistsError
+	var unclean *uncleanRunError
+	switch {
+	case errors.As(err, &exists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "workflowId": exists.WorkflowID})
+		return
+	case errors.As(err, &unclean):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "workflowId": unclean.WorkflowID, "phase": unclean.Phase})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, providerOpts)
+	c.Header("Location", workflowLocation(resp.WorkflowID))
+	if resp.existing {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// ProvisionResponse identifies the workflow provisioning a cluster, the provider options are kept at the top level
+type ProvisionResponse struct {
+	common.ProviderOptions
+	WorkflowID string `json:"workflowId"`
+	RunID      string `json:"runId"`
+	Phase      string `json:"phase"`
+
+	// existing is set when the request repeated one that already started the workflow
+	existing bool
+}
+
+// workflowLocation returns the status resource of a workflow
+func workflowLocation(workflowID string) string {
+	return "/workflow/" + url.PathEscape(workflowID)
+}
+
+// FieldError is one invalid field of a request body
+type FieldError struct {
+	Field  string      `json:"field"`
+	Type   string      `json:"type"`
+	Value  interface{} `json:"value,omitempty"`
+	Detail string      `json:"detail,omitempty"`
+}
+
+// writeFieldErrors responds with 422 and every field error of the request
+func writeFieldErrors(c *gin.Context, errs field.ErrorList) {
+	fields := make([]FieldError, 0, len(errs))
+	for _, err := range errs {
+		fe := FieldError{Field: err.Field, Type: string(err.Type), Detail: err.Detail}
+		if err.Type != field.ErrorTypeRequired {
+			fe.Value = err.BadValue
+		}
+		fields = append(fields, fe)
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid request", "fields": fields})
+}
+
+// resolveCredential loads the named credential of the path owner and writes the error response if it can't be used
+func resolveCredential(c *gin.Context, name, provider string) (*common.CredentialSpec, bool) {
+	ownerID, ok := ownerIDParam(c)
+	if !ok {
+		return nil, false
+	}
+
+	cred, err := credential.Resolve(c.Request.Context(), credStore, ownerID, name, provider)
+	switch {
+	case err == nil:
+		return cred, true
+	case errors.Is(err, credential.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, credential.ErrNameRequired), errors.Is(err, credential.ErrTypeMismatch),
+		errors.Is(err, credential.ErrReservedName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return nil, false
+}
+
+// ownerIDParam parses the owner path parameter and writes the error response if it is not an owner id
+func ownerIDParam(c *gin.Context) (int64, bool) {
+	ownerID, err := strconv.ParseInt(c.Param("owner"), 10, 64)
+	// the owner id starts the object names of credentials, a leading "-" is not a valid name
+	if err != nil || ownerID < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "owner must be a non-negative numeric owner id"})
+		return 0, false
+	}
+	return ownerID, true
 }
 
+// ProvisionCAPICluster starts the entity workflow of the cluster. Its ID is derived from the owner and the cluster
+// name, so a cluster can only be provisioned once while its workflow runs: repeating a request with the same
+// idempotency key returns the running workflow, any other request fails with a clusterExistsError. A closed run is
+// only replaced when it cleaned up after itself, otherwise an uncleanRunError is returned.
 func ProvisionCAPICluster(
 	ctx context.Context,
 	cred *common.CredentialSpec,
 	params common.ClusterProvisionConfig,
 	providerName string,
-) (*common.ProviderOptions, error) {
-	fmt.Printf("Provision capi cluster params: %+v\n", params)
-
+	ownerID int64,
+	idempotencyKey string,
+) (*ProvisionResponse, error) {
 	providerOptions := common.ProviderOptions{}
 	providerOptions.Name = strings.ToUpper(providerName)
 	providerOptions.Region = params.CAPIClusterConfig.Region
@@ -88,38 +265,333 @@ func ProvisionCAPICluster(
 
 	switch providerName {
 	case providerKubevirt:
-		clusterOp := common.KubeVirtCreateOperation{
-			KubeVirtCredential: cred.KubeVirt,
-			CAPIConfig:         &params.CAPIClusterConfig,
-			ImportOption:       params.ImportOptions,
-		}
+		// the kubeconfig of the cluster is stored as a credential of the owner
+		params.ImportOptions.BasicInfo.OwnerID = ownerID
+		clusterOp := newKubevirtCreateOperation(cred, params)
 
-		workflowID := fmt.Sprintf("kubevirt-%s", time.Now().Unix())
+		workflowID := clusterWorkflowID(providerName, ownerID, params.CAPIClusterConfig.ClusterName)
+		if err := checkLastRun(ctx, workflowID); err != nil {
+			return nil, err
+		}
 
+		options := &iwf.WorkflowOptions{
+			// a deleted or compensated cluster of the same name can be provisioned again
+			WorkflowIdReusePolicy: ptr.To(iwfidl.ALLOW_IF_NO_RUNNING),
+		}
+		if idempotencyKey != "" {
+			options.InitialSearchAttributes = map[string]interface{}{
+				kubevirt.IdempotencyKeySearchAttribute: idempotencyKey,
+			}
+		}
 		runID, err := client.StartWorkflow(
 			ctx,
 			kubevirt.KubevirtWorkflow{},
 			workflowID,
-			3600,
+			0, // the workflow stays open as the cluster's entity until it is deleted
 			clusterOp,
-			nil,
+			options,
 		)
+		if iwf.IsWorkflowAlreadyStartedError(err) {
+			runID, err = runningProvision(ctx, workflowID, idempotencyKey)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Workflow %s (runId=%s) already runs for %s", workflowID, runID, title)
+			status, err := describeWorkflow(ctx, workflowID)
+			if err != nil {
+				return nil, err
+			}
+			return &ProvisionResponse{
+				ProviderOptions: providerOptions,
+				WorkflowID:      workflowID,
+				RunID:           runID,
+				Phase:           status.Phase,
+				existing:        true,
+			}, nil
+		}
 		if err != nil {
 			return nil, err
 		}
 
 		log.Printf("Started workflow %s (runId=%s) for %s", workflowID, runID, title)
 
+		return &ProvisionResponse{
+			ProviderOptions: providerOptions,
+			WorkflowID:      workflowID,
+			RunID:           runID,
+			Phase:           PhasePending,
+		}, nil
+
 	default:
 		return nil, errors.New("invalid provider")
 	}
+}
+
+func newKubevirtCreateOperation(cred *common.CredentialSpec, params common.ClusterProvisionConfig) common.KubeVirtCreateOperation {
+	return common.KubeVirtCreateOperation{
+		KubeVirtCredential: cred.KubeVirt,
+		CAPIConfig:         &params.CAPIClusterConfig,
+		ImportOption:       params.ImportOptions,
+	}
+}
+
+// DeleteClusterHandler sends the delete command to the cluster's workflow, which deletes the cluster and closes
+func DeleteClusterHandler(c *gin.Context) {
+	workflowID, ok := clusterWorkflowIDParam(c)
+	if !ok {
+		return
+	}
+	signalReadyCluster(c, workflowID, kubevirt.DeleteClusterSignal, nil)
+}
+
+// ScaleWorkerPoolHandler sends the scale command for the pool to the cluster's workflow
+func ScaleWorkerPoolHandler(c *gin.Context) {
+	workflowID, ok := clusterWorkflowIDParam(c)
+	if !ok {
+		return
+	}
+	var params common.ClusterScaleConfig
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	params.PoolName = c.Param("pool")
+	if params.MachineCount == nil && params.CPU <= 0 && params.Memory <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "one of machineCount, cpu or memory must be set"})
+		return
+	}
+	if params.MachineCount != nil && *params.MachineCount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "machineCount must not be negative"})
+		return
+	}
+	signalReadyCluster(c, workflowID, kubevirt.ScaleClusterSignal, params)
+}
+
+// UpgradeClusterHandler sends the upgrade command to the cluster's workflow
+func UpgradeClusterHandler(c *gin.Context) {
+	workflowID, ok := clusterWorkflowIDParam(c)
+	if !ok {
+		return
+	}
+	var params common.ClusterUpgradeConfig
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	params.KubernetesVersion = strings.TrimPrefix(params.KubernetesVersion, "v")
+	if !common.IsSupportedKubernetesVersion(params.KubernetesVersion) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             fmt.Sprintf("unsupported kubernetes version %q", params.KubernetesVersion),
+			"supportedVersions": common.SupportedKubernetesVersions,
+		})
+		return
+	}
+	signalReadyCluster(c, workflowID, kubevirt.UpgradeClusterSignal, params)
+}
+
+// clusterWorkflowIDParam returns the ID of the workflow of the cluster in the path and writes the error response
+// if the path does not name a cluster
+func clusterWorkflowIDParam(c *gin.Context) (string, bool) {
+	cloudProvider := c.Param("provider")
+	if cloudProvider != providerKubevirt {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported provider"})
+		return "", false
+	}
+	ownerID, ok := ownerIDParam(c)
+	if !ok {
+		return "", false
+	}
+	return clusterWorkflowID(cloudProvider, ownerID, c.Param("name")), true
+}
+
+// UpgradeSignalHandler sends the pause or resume signal to a workflow that runs an upgrade. Without a running
+// upgrade the signal would wait in its channel and pause or resume the next upgrade, so it is refused, as is a
+// resume of an upgrade that is not paused.
+func UpgradeSignalHandler(signalName string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		status, err := describeWorkflow(c.Request.Context(), id)
+		if err != nil {
+			if iwf.IsWorkflowNotExistsError(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "workflow not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if status.Status != iwfidl.RUNNING || !status.upgrading {
+			c.JSON(http.StatusConflict, gin.H{"error": "no upgrade is in progress", "phase": status.Phase})
+			return
+		}
+		if signalName == kubevirt.ResumeUpgradeSignal && !status.paused {
+			c.JSON(http.StatusConflict, gin.H{"error": "the upgrade is not paused", "phase": status.Phase})
+			return
+		}
+		signalWorkflow(c, id, signalName, nil)
+	}
+}
+
+// signalReadyCluster sends a day-2 command to the workflow of a provisioned cluster. A command sent while the
+// cluster is still being provisioned would wait in its channel and be lost if provisioning fails, so it is refused
+// with 409 until the cluster is Ready.
+func signalReadyCluster(c *gin.Context, workflowID, signalName string, value interface{}) {
+	status, err := describeWorkflow(c.Request.Context(), workflowID)
+	if err != nil {
+		if iwf.IsWorkflowNotExistsError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cluster not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if status.Status != iwfidl.RUNNING || !status.Ready {
+		c.JSON(http.StatusConflict, gin.H{"error": "cluster is not ready", "workflowId": workflowID, "phase": status.Phase})
+		return
+	}
+	signalWorkflow(c, workflowID, signalName, value)
+}
+
+func signalWorkflow(c *gin.Context, id, signalName string, value interface{}) {
+	err := client.SignalWorkflow(c.Request.Context(), kubevirt.KubevirtWorkflow{}, id, "", signalName, value)
+	if err != nil {
+		if iwf.IsWorkflowNotExistsError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "workflow not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"workflowId": id, "signal": signalName})
+}
+
+// CancelRequest is the optional body of a cancel request
+type CancelRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// CancelWorkflowHandler aborts a running workflow. A cluster that is still being provisioned gets the cancel signal
+// so its workflow stops provisioning and removes what it created, ?force=true stops the workflow without
+// compensation.
+// A provisioned cluster cannot be cancelled, it is deleted with the delete command.
+func CancelWorkflowHandler(c *gin.Context) {
+	id := c.Param("id")
+	var req CancelRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	force, _ := strconv.ParseBool(c.Query("force"))
+
+	ctx := c.Request.Context()
+	status, err := describeWorkflow(ctx, id)
+	if err != nil {
+		if iwf.IsWorkflowNotExistsError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "workflow not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if status.Status != iwfidl.RUNNING {
+		c.JSON(http.StatusConflict, gin.H{"error": "workflow is not running", "phase": status.Phase})
+		return
+	}
+
+	if !force {
+		// the entity workflow of a provisioned cluster keeps running, whatever day-two command it works on
+		if status.Ready {
+			c.JSON(http.StatusConflict, gin.H{"error": "cluster is already provisioned, delete it instead", "phase": status.Phase})
+			return
+		}
+		signalWorkflow(c, id, kubevirt.CancelProvisionSignal, req.Reason)
+		return
+	}
+
+	err = client.StopWorkflow(ctx, id, "", &iwf.WorkflowStopOptions{
+		StopType: iwfidl.CANCEL,
+		Reason:   req.Reason,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"workflowId": id, "stopped": true})
+}
+
+// RetryRequest is the optional body of a retry request
+type RetryRequest struct {
+	// StateID overrides the state the workflow is reset to
+	StateID string `json:"stateId,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// RetryWorkflowHandler resets a failed provisioning to the state that failed, so it resumes with the namespace of
+// the failed run. A compensated run provisions the cluster from scratch, and is refused while its compensations
+// are pending. A state given in the body overrides the state the workflow is reset to.
+func RetryWorkflowHandler(c *gin.Context) {
+	id := c.Param("id")
+	var req RetryRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "retried through the API"
+	}
 
-	return &providerOptions, nil
+	ctx := c.Request.Context()
+	status, err := describeWorkflow(ctx, id)
+	if err != nil {
+		if iwf.IsWorkflowNotExistsError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "workflow not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	switch status.Status {
+	case iwfidl.FAILED, iwfidl.TIMEOUT, iwfidl.CANCELED, iwfidl.TERMINATED:
+	default:
+		// a reset of a running workflow would run its states a second time next to the current ones
+		c.JSON(http.StatusConflict, gin.H{"error": "only a closed failed, timed out or cancelled workflow can be retried", "phase": status.Phase})
+		return
+	}
+
+	stateID := req.StateID
+	if stateID == "" {
+		if stateID, err = kubevirt.RetryStateID(status.provisionState, status.CleanupReason, status.Compensations); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "phase": status.Phase})
+			return
+		}
+	}
+
+	opts := iwf.ResetToStateId(stateID, req.Reason)
+	runID, err := client.ResetWorkflow(ctx, id, "", &opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("Reset workflow %s to %s (runId=%s)", id, stateID, runID)
+	c.Header("Location", workflowLocation(id))
+	c.JSON(http.StatusAccepted, gin.H{"workflowId": id, "runId": runID, "stateId": stateID})
+}
+
+// ListTemplatesHandler returns the script templates of the catalog with their metadata
+func ListTemplatesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, script.DefaultCatalog().List())
 }
 
 func GetWorkflowHistoryHandler(c *gin.Context) {
 	id := c.Param("id")
-	history := persistence.Get(id)
+	history, err := persistence.Get(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	if len(history) == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"error": "workflow not found"})
 		return
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/kubevirt"
+	"github.com/indeedeng/iwf-golang-sdk/gen/iwfidl"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// clusterExistsError is returned when a cluster of the same name is already provisioned by a running workflow
+type clusterExistsError struct {
+	WorkflowID string
+}
+
+func (e *clusterExistsError) Error() string {
+	return fmt.Sprintf("cluster already exists, it is managed by workflow %s", e.WorkflowID)
+}
+
+// clusterWorkflowID returns the ID of the entity workflow of a cluster, every request for the cluster maps to it
+func clusterWorkflowID(provider string, ownerID int64, clusterName string) string {
+	return fmt.Sprintf("%s-%d-%s", provider, ownerID, clusterName)
+}
+
+// runningProvision returns the run of the running workflow if it was started by a request with idempotencyKey.
+// The key is a search attribute set together with the start, so it is there as soon as the workflow is.
+func runningProvision(ctx context.Context, workflowID, idempotencyKey string) (string, error) {
+	if idempotencyKey == "" {
+		return "", &clusterExistsError{WorkflowID: workflowID}
+	}
+	info, err := client.DescribeWorkflow(ctx, workflowID, "")
+	if err != nil {
+		return "", err
+	}
+	attrs, err := client.GetWorkflowSearchAttributes(ctx, kubevirt.KubevirtWorkflow{}, workflowID, info.CurrentRunId,
+		[]string{kubevirt.IdempotencyKeySearchAttribute})
+	if err != nil {
+		return "", err
+	}
+	if key, _ := attrs[kubevirt.IdempotencyKeySearchAttribute].(string); key != idempotencyKey {
+		return "", &clusterExistsError{WorkflowID: workflowID}
+	}
+	return info.CurrentRunId, nil
+}
+
+// uncleanRunError is returned when the last run of a cluster's workflow closed without cleaning up after itself
+type uncleanRunError struct {
+	WorkflowID string
+	Phase      string
+}
+
+func (e *uncleanRunError) Error() string {
+	return fmt.Sprintf("the last run of workflow %s was not compensated and did not delete its cluster, retry it instead", e.WorkflowID)
+}
+
+// checkLastRun refuses to start a cluster's workflow over a closed run that may have left resources behind. A
+// run that failed without being compensated keeps its namespace, Job and CAPI Cluster for a retry, a new run would
+// orphan them. A running workflow is left to StartWorkflow, which reports it.
+func checkLastRun(ctx context.Context, workflowID string) error {
+	status, err := describeWorkflow(ctx, workflowID)
+	switch {
+	case iwf.IsWorkflowNotExistsError(err):
+		return nil
+	case err != nil:
+		return err
+	case status.Status == iwfidl.RUNNING, kubevirt.RunCleanedUp(status.CleanupReason, status.Compensations):
+		return nil
+	}
+	return &uncleanRunError{WorkflowID: workflowID, Phase: status.Phase}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/credential"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/kubevirt"
+	"github.com/gin-gonic/gin"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+// GetClusterKubeconfigHandler returns the admin kubeconfig of a provisioned cluster of the path owner. Only the
+// credential the workflow wrote for the cluster is returned. It responds with 409 while the cluster is still being
+// provisioned and with 404 when there is no kubeconfig to return.
+func GetClusterKubeconfigHandler(c *gin.Context) {
+	cloudProvider := c.Param("provider")
+	if cloudProvider != providerKubevirt {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported provider"})
+		return
+	}
+	ownerID, ok := ownerIDParam(c)
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+
+	ctx := c.Request.Context()
+	cred, err := credStore.Get(ctx, ownerID, credential.ClusterCredentialName(name))
+	switch {
+	case err == nil && cred.Spec.OwnerID == ownerID && credential.IsClusterCredential(cred, name) &&
+		cred.Spec.KubeVirt != nil && cred.Spec.KubeVirt.KubeConfig != "":
+		c.Data(http.StatusOK, "application/yaml", []byte(cred.Spec.KubeVirt.KubeConfig))
+		return
+	case err != nil && !errors.Is(err, credential.ErrNotFound):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	workflowID := clusterWorkflowID(cloudProvider, ownerID, name)
+	status, err := describeWorkflow(ctx, workflowID)
+	switch {
+	case iwf.IsWorkflowNotExistsError(err):
+		c.JSON(http.StatusNotFound, gin.H{"error": "cluster not found"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case !status.settled():
+		c.JSON(http.StatusConflict, gin.H{"error": "cluster is still being provisioned", "workflowId": workflowID, "phase": status.Phase})
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "cluster has no kubeconfig", "workflowId": workflowID, "phase": status.Phase})
+	}
+}
+
+// RotateClusterKubeconfigHandler sends the rotate command to the cluster's workflow, which has the control plane
+// issue a new admin kubeconfig and stores it in place of the old one
+func RotateClusterKubeconfigHandler(c *gin.Context) {
+	workflowID, ok := clusterWorkflowIDParam(c)
+	if !ok {
+		return
+	}
+	signalReadyCluster(c, workflowID, kubevirt.RotateKubeconfigSignal, nil)
+}
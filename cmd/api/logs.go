@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/persistence"
+	"github.com/gin-gonic/gin"
+	"github.com/indeedeng/iwf-golang-sdk/gen/iwfidl"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+const logPollInterval = 2 * time.Second
+
+// GetWorkflowLogsHandler returns the capi-runner log lines stored for a workflow. With ?follow=true the lines are
+// sent as server-sent "log" events as they arrive, followed by an "end" event with the phase once the operation is
+// over: the workflow closed, or the entity workflow of the cluster waits for the next command.
+func GetWorkflowLogsHandler(c *gin.Context) {
+	id := c.Param("id")
+	follow, _ := strconv.ParseBool(c.Query("follow"))
+	if !follow {
+		lines, err := persistence.GetLogs(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(lines) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no logs for workflow"})
+			return
+		}
+		c.JSON(http.StatusOK, lines)
+		return
+	}
+
+	if _, err := client.DescribeWorkflow(c.Request.Context(), id, ""); err != nil {
+		if iwf.IsWorkflowNotExistsError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "workflow not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	sent := 0
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+	c.Stream(func(w io.Writer) bool {
+		ctx := c.Request.Context()
+		// read the workflow status before the logs, so no line written before it closed is missed
+		status, err := describeWorkflow(ctx, id)
+		if err != nil {
+			c.SSEvent("error", err.Error())
+			return false
+		}
+		lines, err := persistence.GetLogs(ctx, id)
+		if err != nil {
+			c.SSEvent("error", err.Error())
+			return false
+		}
+		for _, line := range lines[min(sent, len(lines)):] {
+			c.SSEvent("log", line)
+		}
+		sent = max(sent, len(lines))
+		if status.Status != iwfidl.RUNNING || status.CurrentState == "clusterEntityState" {
+			c.SSEvent("end", status.Phase)
+			return false
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			return true
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/config"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/script"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
+	"github.com/urfave/cli"
+	"sigs.k8s.io/yaml"
+)
+
+// RenderProvisionCommand is the CLI form of POST .../cluster?dryRun=true. It needs neither a credential nor the hub,
+// the admin kubeconfig is always redacted.
+func RenderProvisionCommand(c *cli.Context) {
+	cfg, err := config.Load(c, config.ComponentAPI)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	script.SetCatalog(script.NewCatalog(cfg.TemplateDir))
+
+	data, err := readProvisionFile(c.String("file"))
+	if err != nil {
+		log.Fatalf("Failed to read provision config: %v", err)
+	}
+	var params common.ClusterProvisionConfig
+	if err := yaml.UnmarshalStrict(data, &params); err != nil {
+		log.Fatalf("Failed to parse provision config: %v", err)
+	}
+	params.Default(cfg.Provision)
+	if errs := params.Validate(cfg.Provision); len(errs) > 0 {
+		log.Fatalf("Invalid provision config: %v", errs.ToAggregate())
+	}
+
+	preview, err := service.PreviewCreate(newKubevirtCreateOperation(&common.CredentialSpec{}, params), cfg.RunnerImages)
+	if err != nil {
+		log.Fatalf("Failed to render provision request: %v", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(preview); err != nil {
+		log.Fatalf("Failed to print preview: %v", err)
+	}
+}
+
+func readProvisionFile(path string) ([]byte, error) {
+	switch path {
+	case "":
+		return nil, cli.NewExitError("--file is required", 1)
+	case "-":
+		return io.ReadAll(os.Stdin)
+	default:
+		return os.ReadFile(path)
+	}
+}
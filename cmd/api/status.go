@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/persistence"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/kubevirt"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
+	"github.com/gin-gonic/gin"
+	"github.com/indeedeng/iwf-golang-sdk/gen/iwfidl"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+const (
+	PhasePending   = "Pending"
+	PhaseRunning   = "Running"
+	PhaseReady     = "Ready"
+	PhaseSucceeded = "Succeeded"
+	PhaseFailed    = "Failed"
+	PhaseTimedOut  = "TimedOut"
+	PhaseCancelled = "Cancelled"
+)
+
+// WorkflowStatus is the status document of a workflow, built only from what the iWF server knows about it
+type WorkflowStatus struct {
+	WorkflowID       string                   `json:"workflowId"`
+	RunID            string                   `json:"runId"`
+	Status           iwfidl.WorkflowStatus    `json:"status"`
+	Phase            string                   `json:"phase"`
+	CurrentState     string                   `json:"currentState,omitempty"`
+	StateStatus      string                   `json:"stateStatus,omitempty"`
+	Namespace        string                   `json:"namespace,omitempty"`
+	CleanupReason    string                   `json:"cleanupReason,omitempty"`
+	Ready            bool                     `json:"ready,omitempty"`
+	Compensations    []string                 `json:"compensations,omitempty"`
+	Error            string                   `json:"error,omitempty"`
+	StartedAt        *time.Time               `json:"startedAt,omitempty"`
+	UpdatedAt        *time.Time               `json:"updatedAt,omitempty"`
+	Progress         *kubevirt.ScriptProgress `json:"progress,omitempty"`
+	SearchAttributes map[string]interface{}   `json:"searchAttributes,omitempty"`
+
+	// provisionState is the provisioning state a retry resumes from
+	provisionState string
+	// upgrading and paused tell whether the entity workflow of a cluster runs an upgrade and whether it is paused
+	upgrading bool
+	paused    bool
+}
+
+func GetWorkflowStatusHandler(c *gin.Context) {
+	id := c.Param("id")
+	status, err := describeWorkflow(c.Request.Context(), id)
+	if err != nil {
+		if iwf.IsWorkflowNotExistsError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "workflow not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !status.settled() {
+		// the states check their job this often
+		c.Header("Retry-After", strconv.Itoa(int(service.RetryInterval.Seconds())))
+		c.JSON(http.StatusAccepted, status)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// settled reports whether the workflow stopped making progress on its own: it closed, or the cluster is ready and
+// its entity workflow waits for commands. Until then the status resource answers 202 with a Retry-After header.
+func (s *WorkflowStatus) settled() bool {
+	return s.Phase != PhasePending && s.Phase != PhaseRunning
+}
+
+func describeWorkflow(ctx context.Context, workflowID string) (*WorkflowStatus, error) {
+	info, err := client.DescribeWorkflow(ctx, workflowID, "")
+	if err != nil {
+		return nil, err
+	}
+	status := &WorkflowStatus{
+		WorkflowID: workflowID,
+		RunID:      info.CurrentRunId,
+		Status:     info.Status,
+	}
+
+	attrs, err := client.GetAllWorkflowDataAttributes(ctx, workflowID, info.CurrentRunId)
+	if err != nil {
+		return nil, err
+	}
+	var startedAt, updatedAt time.Time
+	var progress kubevirt.ScriptProgress
+	for key, ptr := range map[string]interface{}{
+		kubevirt.ProgressAttribute:      &progress,
+		"nsname":                        &status.Namespace,
+		"cleanup_reason":                &status.CleanupReason,
+		kubevirt.ReadyAttribute:         &status.Ready,
+		kubevirt.CompensationsAttribute: &status.Compensations,
+		"upgrading":                     &status.upgrading,
+		"paused":                        &status.paused,
+		kubevirt.CurrentStateAttribute:  &status.CurrentState,
+		kubevirt.StateStatusAttribute:   &status.StateStatus,
+		kubevirt.ErrorAttribute:         &status.Error,
+		kubevirt.StartedAtAttribute:     &startedAt,
+		kubevirt.UpdatedAtAttribute:     &updatedAt,
+	} {
+		if err := decodeAttribute(attrs, key, ptr); err != nil {
+			return nil, err
+		}
+	}
+	if !startedAt.IsZero() {
+		status.StartedAt = &startedAt
+	}
+	if !updatedAt.IsZero() {
+		status.UpdatedAt = &updatedAt
+	}
+	// the data attribute is only written when a state completes, the stored job logs are newer while a script runs
+	if lines, err := persistence.GetLogs(ctx, workflowID); err == nil {
+		if live := kubevirt.ParseScriptProgress(lines); len(live.Steps) > 0 {
+			progress = live
+		}
+	}
+	if len(progress.Steps) > 0 {
+		status.Progress = &progress
+	}
+
+	status.SearchAttributes, err = client.GetAllWorkflowSearchAttributes(ctx, kubevirt.KubevirtWorkflow{}, workflowID, info.CurrentRunId)
+	if err != nil {
+		return nil, err
+	}
+
+	status.Phase = workflowPhase(status)
+	return status, nil
+}
+
+func decodeAttribute(attrs map[string]iwf.Object, key string, ptr interface{}) error {
+	obj, ok := attrs[key]
+	if !ok || obj.EncodedObject == nil {
+		return nil
+	}
+	return obj.ObjectEncoder.Decode(obj.EncodedObject, ptr)
+}
+
+// workflowPhase maps the status of a workflow to its phase. A cancelled provisioning stays Running while its
+// compensations run and is Cancelled once its workflow closed.
+func workflowPhase(status *WorkflowStatus) string {
+	if status.Status != iwfidl.RUNNING && strings.HasPrefix(status.CleanupReason, kubevirt.CleanupReasonCancelled) {
+		return PhaseCancelled
+	}
+	switch status.Status {
+	case iwfidl.COMPLETED:
+		return PhaseSucceeded
+	case iwfidl.FAILED:
+		return PhaseFailed
+	case iwfidl.TIMEOUT:
+		return PhaseTimedOut
+	case iwfidl.CANCELED, iwfidl.TERMINATED:
+		return PhaseCancelled
+	}
+	switch {
+	case status.Ready:
+		return PhaseReady
+	case status.CurrentState == "":
+		return PhasePending
+	default:
+		return PhaseRunning
+	}
+}
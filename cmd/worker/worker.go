@@ -1,15 +1,24 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/config"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/credential"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/persistence"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/script"
 	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
 	"github.com/gin-gonic/gin"
 	"github.com/indeedeng/iwf-golang-sdk/gen/iwfidl"
 	"github.com/indeedeng/iwf-golang-sdk/iwf"
 	"github.com/urfave/cli"
 	"log"
 	"net/http"
-	"sync"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 // BuildCLI is the main entry point for the iwf worker
@@ -25,39 +34,103 @@ func BuildCLI() *cli.App {
 			Aliases: []string{""},
 			Usage:   "start iwf golang samples",
 			Action:  start,
+			Flags:   config.Flags(),
 		},
 	}
 	return app
 }
 
 func start(c *cli.Context) {
-	fmt.Println("start running samples")
-	closeFn := startWorkflowWorker()
-	// TODO improve the waiting with process signal
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	wg.Wait()
-	closeFn()
+	cfg, err := config.Load(c, config.ComponentWorker)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	script.SetCatalog(script.NewCatalog(cfg.TemplateDir))
+	if cfg.RunnerImages.Default == "" && len(cfg.RunnerImages.Providers) == 0 {
+		log.Println("no capi-runner image configured, cluster operations will fail until --runner-image is set")
+	}
+	k8sClient, clientset, err := workflows.NewK8sClients()
+	if err != nil {
+		log.Fatalf("worker needs access to the cluster the capi-runner jobs run on: %v", err)
+	}
+	credStore, err := credential.NewStore(cfg.Credentials.Store, cfg.Credentials.File)
+	if err != nil {
+		log.Fatalf("failed to set up credential store: %v", err)
+	}
+	jobLogs := service.NewLogTailer(k8sClient, clientset)
+	registry, err := workflows.NewRegistry(workflows.Options{
+		K8sClient:    k8sClient,
+		JobLogs:      jobLogs,
+		RunnerImages: cfg.RunnerImages,
+		Credentials:  credStore,
+	})
+	if err != nil {
+		log.Fatalf("failed to register workflows: %v", err)
+	}
+	workerService = iwf.NewWorkerService(registry, cfg.IWF.WorkerOptions())
+
+	historyStore, err := persistence.NewStore(cfg.History.StoreOptions())
+	if err != nil {
+		log.Fatalf("failed to set up history store: %v", err)
+	}
+	persistence.SetStore(historyStore)
+
+	shutdownFn := startWorkflowWorker(cfg.Worker)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-stop
+	log.Printf("received %s, shutting down worker", sig)
+
+	// stop reporting ready first so the iWF server routes new state executions to other workers
+	ready.Store(false)
+	time.Sleep(cfg.Worker.ReadinessGracePeriod.Duration)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Worker.ShutdownTimeout.Duration)
+	defer cancel()
+	err = shutdownFn(ctx)
+	// the copies of capi-runner logs outlive the request that started them, they store what they read before exiting
+	jobLogs.Stop()
+	if err != nil {
+		log.Printf("failed to drain in-flight requests: %v", err)
+		os.Exit(1)
+	}
+	log.Println("worker stopped")
 }
 
-var workerService = iwf.NewWorkerService(workflows.GetRegistry(), nil)
+var workerService iwf.WorkerService
 
-func startWorkflowWorker() (closeFunc func()) {
+// ready is reported by the readiness probe and turned off as soon as the worker starts shutting down
+var ready atomic.Bool
+
+// startWorkflowWorker starts serving the worker APIs and returns a function that drains
+// the in-flight requests and stops the server.
+func startWorkflowWorker(serverConfig config.ServerConfig) (shutdownFunc func(ctx context.Context) error) {
 	router := gin.Default()
 	router.POST(iwf.WorkflowStateWaitUntilApi, apiV1WorkflowStateStart)
 	router.POST(iwf.WorkflowStateExecuteApi, apiV1WorkflowStateDecide)
 	router.POST(iwf.WorkflowWorkerRPCAPI, apiV1WorkflowWorkerRpc)
+	router.GET("/healthz", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/readyz", readiness)
 
-	wfServer := &http.Server{
-		Addr:    ":" + iwf.DefaultWorkerPort,
-		Handler: router,
-	}
+	wfServer := serverConfig.NewServer(router)
 	go func() {
-		if err := wfServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := serverConfig.ListenAndServe(wfServer); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("listen: %s\n", err)
 		}
 	}()
-	return func() { wfServer.Close() }
+	ready.Store(true)
+	return wfServer.Shutdown
+}
+
+func readiness(c *gin.Context) {
+	if !ready.Load() {
+		c.Status(http.StatusServiceUnavailable)
+		return
+	}
+	c.Status(http.StatusOK)
 }
 
 func apiV1WorkflowStateStart(c *gin.Context) {
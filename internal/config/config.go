@@ -0,0 +1,434 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"time"
+	"unsafe"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/persistence"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/kubevirt"
+	"github.com/indeedeng/iwf-golang-sdk/gen/iwfidl"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+	"github.com/urfave/cli"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Components a Config is loaded for, they decide which server the listen flags apply to
+const (
+	ComponentAPI    = "api"
+	ComponentWorker = "worker"
+)
+
+// Config is shared by the API server and the worker. Values come from the defaults, then the YAML file
+// given by --config, then environment variables and flags.
+type Config struct {
+	IWF    IWFConfig    `json:"iwf"`
+	API    ServerConfig `json:"api"`
+	Worker ServerConfig `json:"worker"`
+	// RunnerImages is used by the worker, per provider and per version overrides can only be set in the config file
+	RunnerImages common.RunnerImages `json:"runnerImages"`
+	// Provision bounds what provision requests accept
+	Provision common.ProvisionLimits `json:"provision"`
+	// TemplateDir holds script templates that replace the embedded ones with the same file name
+	TemplateDir string `json:"templateDir,omitempty"`
+	// Credentials selects where credentials and the kubeconfigs of provisioned clusters are stored
+	Credentials CredentialConfig `json:"credentials"`
+	// History selects where workflow history and job logs are kept, the API and the worker must share it
+	History HistoryConfig `json:"history"`
+}
+
+// CredentialConfig selects the credential store
+type CredentialConfig struct {
+	// Store is kubernetes or file
+	Store string `json:"store,omitempty"`
+	// File holds the Credential objects of the file store
+	File string `json:"file,omitempty"`
+}
+
+// HistoryConfig selects the history store
+type HistoryConfig struct {
+	// Store is configmap, file or memory. The memory store only serves an API and worker in one process.
+	Store     string `json:"store,omitempty"`
+	Dir       string `json:"dir,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// IWFConfig holds how the iWF server is reached and how it reaches the worker
+type IWFConfig struct {
+	ServerURL          string `json:"serverUrl,omitempty"`
+	WorkerURL          string `json:"workerUrl,omitempty"`
+	CAFile             string `json:"caFile,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	// RequestTimeout bounds each request the iWF client sends, it does not apply to any other HTTP client
+	RequestTimeout metav1.Duration `json:"requestTimeout,omitempty"`
+}
+
+// ServerConfig configures one of the HTTP servers
+type ServerConfig struct {
+	ListenAddress string          `json:"listenAddress,omitempty"`
+	TLS           TLSConfig       `json:"tls,omitempty"`
+	ReadTimeout   metav1.Duration `json:"readTimeout,omitempty"`
+	WriteTimeout  metav1.Duration `json:"writeTimeout,omitempty"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish on shutdown
+	ShutdownTimeout metav1.Duration `json:"shutdownTimeout,omitempty"`
+	// ReadinessGracePeriod is how long the server reports not ready before it stops accepting requests
+	ReadinessGracePeriod metav1.Duration `json:"readinessGracePeriod,omitempty"`
+}
+
+type TLSConfig struct {
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+}
+
+func defaults() Config {
+	return Config{
+		IWF: IWFConfig{
+			ServerURL:      "http://localhost:" + iwf.DefaultServerPort,
+			WorkerURL:      "http://localhost:" + iwf.DefaultWorkerPort,
+			RequestTimeout: metav1.Duration{Duration: 30 * time.Second},
+		},
+		API: ServerConfig{
+			ListenAddress: ":8080",
+			ReadTimeout:   metav1.Duration{Duration: 30 * time.Second},
+		},
+		Worker: ServerConfig{
+			ListenAddress:        ":" + iwf.DefaultWorkerPort,
+			ReadTimeout:          metav1.Duration{Duration: 30 * time.Second},
+			ShutdownTimeout:      metav1.Duration{Duration: kubevirt.MaxExecuteTimeout()},
+			ReadinessGracePeriod: metav1.Duration{Duration: 5 * time.Second},
+		},
+		Provision: common.DefaultProvisionLimits(),
+		Credentials: CredentialConfig{
+			Store: "kubernetes",
+		},
+		History: HistoryConfig{
+			Store:     persistence.StoreConfigMap,
+			Namespace: metav1.NamespaceDefault,
+		},
+	}
+}
+
+// Flags returns the flags both commands accept
+func Flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			EnvVar: "IWF_POC_CONFIG",
+			Usage:  "path of a YAML config file",
+		},
+		cli.StringFlag{
+			Name:   "iwf-server-url",
+			EnvVar: "IWF_SERVER_URL",
+			Usage:  "URL of the iWF server",
+		},
+		cli.StringFlag{
+			Name:   "iwf-worker-url",
+			EnvVar: "IWF_WORKER_URL",
+			Usage:  "URL the iWF server uses to reach the worker",
+		},
+		cli.StringFlag{
+			Name:   "iwf-ca-file",
+			EnvVar: "IWF_CA_FILE",
+			Usage:  "CA bundle used to verify the iWF server certificate",
+		},
+		cli.BoolFlag{
+			Name:   "iwf-insecure-skip-verify",
+			EnvVar: "IWF_INSECURE_SKIP_VERIFY",
+			Usage:  "skip verification of the iWF server certificate",
+		},
+		cli.DurationFlag{
+			Name:   "iwf-request-timeout",
+			EnvVar: "IWF_REQUEST_TIMEOUT",
+			Usage:  "timeout of a request of the API to the iWF server",
+		},
+		cli.StringFlag{
+			Name:   "listen-address",
+			EnvVar: "LISTEN_ADDRESS",
+			Usage:  "address the server listens on",
+		},
+		cli.StringFlag{
+			Name:   "tls-cert-file",
+			EnvVar: "TLS_CERT_FILE",
+			Usage:  "certificate served by the server, plain HTTP is used when empty",
+		},
+		cli.StringFlag{
+			Name:   "tls-key-file",
+			EnvVar: "TLS_KEY_FILE",
+			Usage:  "private key of --tls-cert-file",
+		},
+		cli.DurationFlag{
+			Name:   "read-timeout",
+			EnvVar: "READ_TIMEOUT",
+			Usage:  "maximum duration for reading a request",
+		},
+		cli.DurationFlag{
+			Name:   "write-timeout",
+			EnvVar: "WRITE_TIMEOUT",
+			Usage:  "maximum duration for writing a response, 0 disables it",
+		},
+		cli.DurationFlag{
+			Name:   "shutdown-timeout",
+			EnvVar: "SHUTDOWN_TIMEOUT",
+			Usage:  "how long in-flight requests may take to finish on shutdown",
+		},
+		cli.DurationFlag{
+			Name:   "readiness-grace-period",
+			EnvVar: "READINESS_GRACE_PERIOD",
+			Usage:  "how long the server reports not ready before it stops accepting requests",
+		},
+		cli.StringFlag{
+			Name:   "template-dir",
+			EnvVar: "TEMPLATE_DIR",
+			Usage:  "directory of script templates overriding the embedded ones",
+		},
+		cli.StringFlag{
+			Name:   "runner-image",
+			EnvVar: "RUNNER_IMAGE",
+			Usage:  "default image of the capi-runner Job",
+		},
+		cli.StringSliceFlag{
+			Name:   "runner-image-pull-secret",
+			EnvVar: "RUNNER_IMAGE_PULL_SECRETS",
+			Usage:  "image pull secret copied into the namespace of every capi-runner Job, can be repeated",
+		},
+		cli.StringFlag{
+			Name:   "runner-image-pull-secret-namespace",
+			EnvVar: "RUNNER_IMAGE_PULL_SECRET_NAMESPACE",
+			Usage:  "namespace the image pull secrets are copied from",
+		},
+		cli.StringFlag{
+			Name:   "credential-store",
+			EnvVar: "CREDENTIAL_STORE",
+			Usage:  "where credentials and the kubeconfigs of provisioned clusters are stored: kubernetes or file",
+		},
+		cli.StringFlag{
+			Name:   "credential-file",
+			EnvVar: "CREDENTIAL_FILE",
+			Usage:  "path of the YAML file holding Credential objects, used with --credential-store=file",
+		},
+		cli.StringFlag{
+			Name:   "history-store",
+			EnvVar: "HISTORY_STORE",
+			Usage:  "where workflow history is kept: configmap, file or memory. The API and the worker must share it, the memory store only serves a single process",
+		},
+		cli.StringFlag{
+			Name:   "history-dir",
+			EnvVar: "HISTORY_DIR",
+			Usage:  "directory of the file history store",
+		},
+		cli.StringFlag{
+			Name:   "history-namespace",
+			EnvVar: "HISTORY_NAMESPACE",
+			Usage:  "namespace of the configmap history store",
+		},
+	}
+}
+
+// Load builds the Config for the given component from the defaults, the config file and the flags
+func Load(c *cli.Context, component string) (*Config, error) {
+	cfg := defaults()
+	if path := c.String("config"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if c.IsSet("iwf-server-url") {
+		cfg.IWF.ServerURL = c.String("iwf-server-url")
+	}
+	if c.IsSet("iwf-worker-url") {
+		cfg.IWF.WorkerURL = c.String("iwf-worker-url")
+	}
+	if c.IsSet("iwf-ca-file") {
+		cfg.IWF.CAFile = c.String("iwf-ca-file")
+	}
+	if c.IsSet("iwf-insecure-skip-verify") {
+		cfg.IWF.InsecureSkipVerify = c.Bool("iwf-insecure-skip-verify")
+	}
+	if c.IsSet("iwf-request-timeout") {
+		cfg.IWF.RequestTimeout.Duration = c.Duration("iwf-request-timeout")
+	}
+
+	server := &cfg.API
+	if component == ComponentWorker {
+		server = &cfg.Worker
+	}
+	if c.IsSet("listen-address") {
+		server.ListenAddress = c.String("listen-address")
+	}
+	if c.IsSet("tls-cert-file") {
+		server.TLS.CertFile = c.String("tls-cert-file")
+	}
+	if c.IsSet("tls-key-file") {
+		server.TLS.KeyFile = c.String("tls-key-file")
+	}
+	if c.IsSet("read-timeout") {
+		server.ReadTimeout.Duration = c.Duration("read-timeout")
+	}
+	if c.IsSet("write-timeout") {
+		server.WriteTimeout.Duration = c.Duration("write-timeout")
+	}
+	if c.IsSet("shutdown-timeout") {
+		server.ShutdownTimeout.Duration = c.Duration("shutdown-timeout")
+	}
+	if c.IsSet("readiness-grace-period") {
+		server.ReadinessGracePeriod.Duration = c.Duration("readiness-grace-period")
+	}
+
+	if (server.TLS.CertFile == "") != (server.TLS.KeyFile == "") {
+		return nil, fmt.Errorf("tls cert file and key file must be set together")
+	}
+
+	if c.IsSet("template-dir") {
+		cfg.TemplateDir = c.String("template-dir")
+	}
+	if c.IsSet("runner-image") {
+		cfg.RunnerImages.Default = c.String("runner-image")
+	}
+	if c.IsSet("runner-image-pull-secret") {
+		cfg.RunnerImages.PullSecrets = c.StringSlice("runner-image-pull-secret")
+	}
+	if c.IsSet("runner-image-pull-secret-namespace") {
+		cfg.RunnerImages.PullSecretNamespace = c.String("runner-image-pull-secret-namespace")
+	}
+	if c.IsSet("credential-store") {
+		cfg.Credentials.Store = c.String("credential-store")
+	}
+	if c.IsSet("credential-file") {
+		cfg.Credentials.File = c.String("credential-file")
+	}
+	if c.IsSet("history-store") {
+		cfg.History.Store = c.String("history-store")
+	}
+	if c.IsSet("history-dir") {
+		cfg.History.Dir = c.String("history-dir")
+	}
+	if c.IsSet("history-namespace") {
+		cfg.History.Namespace = c.String("history-namespace")
+	}
+	if len(cfg.RunnerImages.PullSecrets) > 0 && cfg.RunnerImages.PullSecretNamespace == "" {
+		return nil, fmt.Errorf("runner image pull secrets need a namespace to be copied from")
+	}
+	if err := cfg.Provision.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid provision limits: %w", err)
+	}
+	return &cfg, nil
+}
+
+// StoreOptions returns the options of the history store
+func (c HistoryConfig) StoreOptions() persistence.Options {
+	return persistence.Options{
+		Kind:      c.Store,
+		Dir:       c.Dir,
+		Namespace: c.Namespace,
+	}
+}
+
+// ClientOptions returns the options of the iWF client
+func (c IWFConfig) ClientOptions() *iwf.ClientOptions {
+	return &iwf.ClientOptions{
+		ServerUrl:     c.ServerURL,
+		WorkerUrl:     c.WorkerURL,
+		ObjectEncoder: c.objectEncoder(),
+	}
+}
+
+// WorkerOptions returns the options of the iWF worker service. The SDK only takes the object encoder there, it
+// has to match the one of ClientOptions; the worker's address, TLS and timeouts are applied by ServerConfig.NewServer.
+func (c IWFConfig) WorkerOptions() *iwf.WorkerOptions {
+	return &iwf.WorkerOptions{
+		ObjectEncoder: c.objectEncoder(),
+	}
+}
+
+// objectEncoder encodes the workflow inputs, data attributes and signal values of both the API and the worker
+func (c IWFConfig) objectEncoder() iwf.ObjectEncoder {
+	return iwf.GetDefaultObjectEncoder()
+}
+
+// NewClient returns the iWF client of the registry, its requests use the timeout and TLS settings of c. The
+// configured HTTP client is set on the configuration of the generated iwfidl client only, http.DefaultClient is
+// never touched.
+func (c IWFConfig) NewClient(registry iwf.Registry) (iwf.Client, error) {
+	httpClient, err := c.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	client := iwf.NewClient(registry, c.ClientOptions())
+	apiConfig, err := iwfAPIConfig(client)
+	if err != nil {
+		return nil, err
+	}
+	apiConfig.HTTPClient = httpClient
+	return client, nil
+}
+
+// iwfAPIConfig returns the configuration of the generated iwfidl client an iwf.Client sends its requests with. The
+// SDK builds that client itself and keeps it in an unexported field, so it is reached by reflection; a layout the
+// SDK changed is reported as an error instead of falling back to http.DefaultClient.
+func iwfAPIConfig(client iwf.Client) (*iwfidl.Configuration, error) {
+	impl := reflect.ValueOf(client)
+	if impl.Kind() != reflect.Ptr || impl.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unexpected iWF client %T", client)
+	}
+	unregistered := impl.Elem().FieldByName("UnregisteredClient")
+	if unregistered.Kind() != reflect.Interface || unregistered.IsNil() || unregistered.Elem().Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("iWF client %T has no unregistered client", client)
+	}
+	apiClient := unregistered.Elem().Elem().FieldByName("apiClient")
+	if !apiClient.IsValid() || apiClient.Type() != reflect.TypeOf(&iwfidl.APIClient{}) || apiClient.IsNil() {
+		return nil, fmt.Errorf("iWF client %T has no iwfidl API client", client)
+	}
+	return (*(**iwfidl.APIClient)(unsafe.Pointer(apiClient.UnsafeAddr()))).GetConfig(), nil
+}
+
+// httpClient returns the client requests to the iWF server are sent with
+func (c IWFConfig) httpClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		ca, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read iWF CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{
+		Transport: transport,
+		Timeout:   c.RequestTimeout.Duration,
+	}, nil
+}
+
+// NewServer returns an http.Server for the handler with the configured address and timeouts
+func (s ServerConfig) NewServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         s.ListenAddress,
+		Handler:      handler,
+		ReadTimeout:  s.ReadTimeout.Duration,
+		WriteTimeout: s.WriteTimeout.Duration,
+	}
+}
+
+// ListenAndServe serves plain HTTP, or HTTPS when a certificate is configured
+func (s ServerConfig) ListenAndServe(srv *http.Server) error {
+	if s.TLS.CertFile != "" {
+		return srv.ListenAndServeTLS(s.TLS.CertFile, s.TLS.KeyFile)
+	}
+	return srv.ListenAndServe()
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewClient(t *testing.T) {
+	defaultClient := http.DefaultClient
+	cfg := IWFConfig{ServerURL: "http://localhost:8801", RequestTimeout: metav1.Duration{Duration: 7 * time.Second}}
+
+	client, err := cfg.NewClient(iwf.NewRegistry())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	apiConfig, err := iwfAPIConfig(client)
+	if err != nil {
+		t.Fatalf("iwfAPIConfig() error = %v", err)
+	}
+	if apiConfig.HTTPClient == http.DefaultClient || apiConfig.HTTPClient.Timeout != 7*time.Second {
+		t.Errorf("iWF client sends with %+v, want the configured client", apiConfig.HTTPClient)
+	}
+	if http.DefaultClient != defaultClient || http.DefaultClient.Timeout != 0 {
+		t.Errorf("http.DefaultClient was changed to %+v", http.DefaultClient)
+	}
+}
@@ -0,0 +1,126 @@
+package credential
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+type fileStore struct {
+	path string
+	// mu serializes the read-modify-write of Put within the process
+	mu sync.Mutex
+}
+
+// NewFileStore returns a Store that reads Credential objects from a YAML or JSON file,
+// multiple objects are separated by "---". The file is re-read on every lookup.
+func NewFileStore(path string) Store {
+	return &fileStore{path: path}
+}
+
+func (s *fileStore) Get(ctx context.Context, ownerID int64, name string) (*common.Credential, error) {
+	creds, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	for _, cred := range creds {
+		if matches(cred, ownerID, name) {
+			return cred, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *fileStore) Put(ctx context.Context, cred *common.Credential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	creds, err := s.read()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	replaced := false
+	for i, existing := range creds {
+		if matches(existing, cred.Spec.OwnerID, cred.Spec.Name) {
+			creds[i] = cred
+			replaced = true
+		}
+	}
+	if !replaced {
+		creds = append(creds, cred)
+	}
+	return s.write(creds)
+}
+
+// Delete rewrites the file without the credential of the owner and name
+func (s *fileStore) Delete(ctx context.Context, ownerID int64, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	creds, err := s.read()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	kept := creds[:0]
+	for _, cred := range creds {
+		if !matches(cred, ownerID, name) {
+			kept = append(kept, cred)
+		}
+	}
+	if len(kept) == len(creds) {
+		return nil
+	}
+	return s.write(kept)
+}
+
+func (s *fileStore) write(creds []*common.Credential) error {
+	var buf bytes.Buffer
+	for i, c := range creds {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		data, err := sigsyaml.Marshal(c)
+		if err != nil {
+			return errors.Wrapf(err, "failed to encode credential %s", c.Spec.Name)
+		}
+		buf.Write(data)
+	}
+	// write a sibling file and rename it, so readers never see a partly written file
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return errors.Wrap(err, "failed to write credential file")
+	}
+	return errors.Wrap(os.Rename(tmp, s.path), "failed to write credential file")
+}
+
+func (s *fileStore) read() ([]*common.Credential, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open credential file")
+	}
+	defer f.Close()
+
+	var creds []*common.Credential
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		cred := &common.Credential{}
+		if err := decoder.Decode(cred); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrapf(err, "failed to decode credential file %s", s.path)
+		}
+		creds = append(creds, cred)
+	}
+	return creds, nil
+}
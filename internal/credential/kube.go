@@ -0,0 +1,121 @@
+package credential
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/pkg/errors"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	credentialGVK = schema.GroupVersionKind{
+		Group:   common.CredentialGroup,
+		Version: common.CredentialVersion,
+		Kind:    common.ResourceKindCredential,
+	}
+	credentialListGVK = credentialGVK.GroupVersion().WithKind(common.ResourceKindCredential + "List")
+)
+
+type kubeStore struct {
+	kc client.Client
+}
+
+// NewKubeStore returns a Store backed by the cluster-scoped Credential resources. A Credential is found by its
+// OwnerLabel and NameLabel, Put sets them on the resources it writes.
+func NewKubeStore(kc client.Client) Store {
+	return &kubeStore{kc: kc}
+}
+
+// credentialLabels returns existing with the labels of cred and the owner and name labels the store looks it up
+// by written over them
+func credentialLabels(existing map[string]string, cred *common.Credential) map[string]string {
+	labels := map[string]string{}
+	for k, v := range existing {
+		labels[k] = v
+	}
+	for k, v := range cred.Labels {
+		labels[k] = v
+	}
+	labels[OwnerLabel] = strconv.FormatInt(cred.Spec.OwnerID, 10)
+	labels[NameLabel] = cred.Spec.Name
+	return labels
+}
+
+func (s *kubeStore) Get(ctx context.Context, ownerID int64, name string) (*common.Credential, error) {
+	if len(validation.IsValidLabelValue(name)) > 0 {
+		// no Credential can carry the name in its label
+		return nil, ErrNotFound
+	}
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(credentialListGVK)
+	selector := client.MatchingLabels{OwnerLabel: strconv.FormatInt(ownerID, 10), NameLabel: name}
+	if err := s.kc.List(ctx, list, selector); err != nil {
+		return nil, errors.Wrap(err, "failed to list credentials")
+	}
+
+	for _, item := range list.Items {
+		cred := &common.Credential{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, cred); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode credential %s", item.GetName())
+		}
+		if matches(cred, ownerID, name) {
+			return cred, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Put updates the spec of the matching Credential resource, a new one is named after the owner and the name
+func (s *kubeStore) Put(ctx context.Context, cred *common.Credential) error {
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&cred.Spec)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode credential %s", cred.Spec.Name)
+	}
+
+	existing, err := s.Get(ctx, cred.Spec.OwnerID, cred.Spec.Name)
+	switch {
+	case err == nil:
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(credentialGVK)
+		if err := s.kc.Get(ctx, client.ObjectKey{Name: existing.Name}, obj); err != nil {
+			return errors.Wrapf(err, "failed to get credential %s", existing.Name)
+		}
+		obj.Object["spec"] = spec
+		obj.SetLabels(credentialLabels(obj.GetLabels(), cred))
+		return errors.Wrapf(s.kc.Update(ctx, obj), "failed to update credential %s", existing.Name)
+	case errors.Is(err, ErrNotFound):
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+		obj.SetGroupVersionKind(credentialGVK)
+		obj.SetName(fmt.Sprintf("%d-%s", cred.Spec.OwnerID, cred.Spec.Name))
+		obj.SetLabels(credentialLabels(nil, cred))
+		return errors.Wrapf(s.kc.Create(ctx, obj), "failed to create credential %s", obj.GetName())
+	default:
+		return err
+	}
+}
+
+// Delete removes the Credential resource matching the owner and the name
+func (s *kubeStore) Delete(ctx context.Context, ownerID int64, name string) error {
+	existing, err := s.Get(ctx, ownerID, name)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(credentialGVK)
+	obj.SetName(existing.Name)
+	if err := s.kc.Delete(ctx, obj); err != nil && !kerr.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete credential %s", existing.Name)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package credential
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestKubeStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewKubeStore(fake.NewClientBuilder().Build())
+
+	infra := &common.Credential{Spec: common.CredentialSpec{Name: "infra", Type: common.CredentialTypeKubeVirt, OwnerID: 1}}
+	if err := store.Put(ctx, infra); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := store.Put(ctx, NewClusterCredential(1, "demo", "apiVersion: v1\nkind: Config\n")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	// a second Put replaces the kubeconfig and keeps the cluster label
+	if err := store.Put(ctx, NewClusterCredential(1, "demo", "apiVersion: v1\nkind: Config\nclusters: []\n")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		ownerID  int64
+		credName string
+		wantErr  error
+	}{
+		{name: "logical name", ownerID: 1, credName: "infra"},
+		{name: "cluster kubeconfig", ownerID: 1, credName: ClusterCredentialName("demo")},
+		{name: "object name", ownerID: 1, credName: "1-" + ClusterCredentialName("demo"), wantErr: ErrNotFound},
+		{name: "other owner", ownerID: 2, credName: "infra", wantErr: ErrNotFound},
+		{name: "invalid label value", ownerID: 1, credName: "not a label", wantErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cred, err := store.Get(ctx, tt.ownerID, tt.credName)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("Get() error = %v, want none", err)
+			case cred.Spec.Name != tt.credName:
+				t.Errorf("Get() = %s, want %s", cred.Spec.Name, tt.credName)
+			}
+		})
+	}
+
+	cred, err := store.Get(ctx, 1, ClusterCredentialName("demo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsClusterCredential(cred, "demo") || cred.Spec.KubeVirt.KubeConfig != "apiVersion: v1\nkind: Config\nclusters: []\n" {
+		t.Errorf("Get() = %+v, want the replaced kubeconfig of cluster demo", cred)
+	}
+
+	if err := store.Delete(ctx, 1, ClusterCredentialName("demo")); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, 1, ClusterCredentialName("demo")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, ErrNotFound)
+	}
+	// deleting it again is not an error and leaves the other credentials alone
+	if err := store.Delete(ctx, 1, ClusterCredentialName("demo")); err != nil {
+		t.Fatalf("second Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, 1, "infra"); err != nil {
+		t.Errorf("Get() of the remaining credential error = %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package credential
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// ErrNotFound is returned when no credential exists for the given owner and name
+var ErrNotFound = errors.New("credential not found")
+
+// ErrTypeMismatch is returned when a credential exists but cannot be used with the requested provider
+var ErrTypeMismatch = errors.New("credential type does not match provider")
+
+// ErrNameRequired is returned when the request does not name a credential
+var ErrNameRequired = errors.New("credential name is required")
+
+// ErrReservedName is returned when a credential of a user takes a name reserved for cluster kubeconfigs
+var ErrReservedName = errors.New("credential name is reserved for cluster kubeconfigs")
+
+const (
+	// clusterCredentialPrefix starts the names of the credentials holding cluster kubeconfigs
+	clusterCredentialPrefix = "cluster-"
+	// ClusterLabel is set on the credential of a cluster kubeconfig, its value is the cluster name
+	ClusterLabel = "iwf.cadence.dev/cluster"
+	// OwnerLabel and NameLabel carry the owner and the logical name of a Credential resource, the Kubernetes store
+	// looks credentials up by them
+	OwnerLabel = "iwf.cadence.dev/owner"
+	NameLabel  = "iwf.cadence.dev/credential"
+)
+
+// Store loads Credential objects by owner and name
+type Store interface {
+	Get(ctx context.Context, ownerID int64, name string) (*common.Credential, error)
+	// Put creates the credential or replaces the one of the same owner and name
+	Put(ctx context.Context, cred *common.Credential) error
+	// Delete removes the credential of the owner and name, a missing one is not an error
+	Delete(ctx context.Context, ownerID int64, name string) error
+}
+
+// NewStore returns the Store of the given kind: kubernetes or file, path is the file of the file store
+func NewStore(kind, path string) (Store, error) {
+	switch kind {
+	case "file":
+		if path == "" {
+			return nil, errors.New("a credential file is required for the file credential store")
+		}
+		return NewFileStore(path), nil
+	case "kubernetes":
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return nil, err
+		}
+		kc, err := client.New(cfg, client.Options{})
+		if err != nil {
+			return nil, err
+		}
+		return NewKubeStore(kc), nil
+	default:
+		return nil, fmt.Errorf("unknown credential store %q", kind)
+	}
+}
+
+// ClusterCredentialName returns the name of the credential holding the admin kubeconfig of a provisioned cluster.
+// The prefix is reserved, Resolve refuses it, so a credential of the user never takes the place of a kubeconfig.
+func ClusterCredentialName(clusterName string) string {
+	return clusterCredentialPrefix + clusterName
+}
+
+// IsClusterCredential reports whether cred holds the admin kubeconfig of the named cluster
+func IsClusterCredential(cred *common.Credential, clusterName string) bool {
+	return cred.Spec.Name == ClusterCredentialName(clusterName) && cred.Labels[ClusterLabel] == clusterName
+}
+
+// NewClusterCredential returns the credential of the cluster's admin kubeconfig
+func NewClusterCredential(ownerID int64, clusterName, kubeconfig string) *common.Credential {
+	return &common.Credential{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{ClusterLabel: clusterName},
+		},
+		Spec: common.CredentialSpec{
+			Name:     ClusterCredentialName(clusterName),
+			Type:     common.CredentialTypeKubeVirt,
+			OwnerID:  ownerID,
+			KubeVirt: &common.KubeVirtCredential{KubeConfig: kubeconfig},
+		},
+	}
+}
+
+// Resolve loads the named credential and checks that it can be used with the given provider
+func Resolve(ctx context.Context, store Store, ownerID int64, name, provider string) (*common.CredentialSpec, error) {
+	if name == "" {
+		return nil, ErrNameRequired
+	}
+	if strings.HasPrefix(name, clusterCredentialPrefix) {
+		return nil, errors.Wrapf(ErrReservedName, "credential %q", name)
+	}
+	cred, err := store.Get(ctx, ownerID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	credType, err := TypeForProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+	if cred.Spec.Type != credType {
+		return nil, errors.Wrapf(ErrTypeMismatch, "credential %q is of type %s, provider %s needs %s", name, cred.Spec.Type, provider, credType)
+	}
+
+	switch credType {
+	case common.CredentialTypeKubeVirt:
+		if cred.Spec.KubeVirt == nil || cred.Spec.KubeVirt.KubeConfig == "" {
+			return nil, fmt.Errorf("credential %q has no kubevirt kubeconfig", name)
+		}
+	}
+	return &cred.Spec, nil
+}
+
+// TypeForProvider returns the credential type a cloud provider expects
+func TypeForProvider(provider string) (common.CredentialType, error) {
+	switch strings.ToLower(provider) {
+	case "kubevirt":
+		return common.CredentialTypeKubeVirt, nil
+	default:
+		return "", fmt.Errorf("no credential type known for provider %q", provider)
+	}
+}
+
+// matches reports whether cred is the credential of the owner with the logical name. The name of the object is
+// not compared, it embeds the name of a cluster kubeconfig and would get around the reserved prefix.
+func matches(cred *common.Credential, ownerID int64, name string) bool {
+	return cred.Spec.OwnerID == ownerID && cred.Spec.Name == name
+}
@@ -0,0 +1,103 @@
+package credential
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+)
+
+const testCredentials = `spec:
+  name: infra
+  type: KubeVirt
+  ownerID: 1
+  kubevirt:
+    kubeConfig: "apiVersion: v1\nkind: Config\n"
+---
+spec:
+  name: empty
+  type: KubeVirt
+  ownerID: 1
+  kubevirt: {}
+---
+spec:
+  name: aws
+  type: Aws
+  ownerID: 1
+---
+metadata:
+  name: 1-cluster-demo
+  labels:
+    iwf.cadence.dev/cluster: demo
+spec:
+  name: cluster-demo
+  type: KubeVirt
+  ownerID: 1
+  kubevirt:
+    kubeConfig: "apiVersion: v1\nkind: Config\n"
+`
+
+func TestResolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.yaml")
+	if err := os.WriteFile(path, []byte(testCredentials), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store := NewFileStore(path)
+
+	tests := []struct {
+		name     string
+		ownerID  int64
+		credName string
+		provider string
+		wantErr  error
+		wantAny  bool
+	}{
+		{name: "kubevirt credential", ownerID: 1, credName: "infra", provider: "kubevirt"},
+		{name: "provider in upper case", ownerID: 1, credName: "infra", provider: "KUBEVIRT"},
+		{name: "no name", ownerID: 1, provider: "kubevirt", wantErr: ErrNameRequired},
+		{name: "reserved name", ownerID: 1, credName: ClusterCredentialName("demo"), provider: "kubevirt", wantErr: ErrReservedName},
+		{name: "unknown name", ownerID: 1, credName: "missing", provider: "kubevirt", wantErr: ErrNotFound},
+		{name: "object name of a cluster kubeconfig", ownerID: 1, credName: "1-cluster-demo", provider: "kubevirt", wantErr: ErrNotFound},
+		{name: "other owner", ownerID: 2, credName: "infra", provider: "kubevirt", wantErr: ErrNotFound},
+		{name: "type of another provider", ownerID: 1, credName: "aws", provider: "kubevirt", wantErr: ErrTypeMismatch},
+		{name: "unknown provider", ownerID: 1, credName: "infra", provider: "openstack", wantAny: true},
+		{name: "no kubeconfig", ownerID: 1, credName: "empty", provider: "kubevirt", wantAny: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := Resolve(context.Background(), store, tt.ownerID, tt.credName, tt.provider)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantAny:
+				if err == nil {
+					t.Fatalf("Resolve() = %+v, want an error", spec)
+				}
+			case err != nil:
+				t.Fatalf("Resolve() error = %v, want none", err)
+			case spec.Name != tt.credName:
+				t.Errorf("Resolve() = %s, want %s", spec.Name, tt.credName)
+			}
+		})
+	}
+}
+
+func TestClusterCredential(t *testing.T) {
+	cred := NewClusterCredential(1, "demo", "apiVersion: v1\nkind: Config\n")
+	if !IsClusterCredential(cred, "demo") {
+		t.Errorf("IsClusterCredential() = false for the credential of cluster demo")
+	}
+	if IsClusterCredential(cred, "other") {
+		t.Errorf("IsClusterCredential() = true for the credential of another cluster")
+	}
+	user := &common.Credential{Spec: common.CredentialSpec{Name: ClusterCredentialName("demo"), OwnerID: 1}}
+	if IsClusterCredential(user, "demo") {
+		t.Errorf("IsClusterCredential() = true for a credential without the cluster label")
+	}
+}
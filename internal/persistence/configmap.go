@@ -0,0 +1,225 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	cu "kmodules.xyz/client-go/client"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	configMapPrefix         = "wf-history-"
+	logConfigMapPrefix      = "wf-logs-"
+	workflowIDAnnotationKey = "iwf.cadence.dev/workflow-id"
+)
+
+// maxConfigMapDataSize keeps the data of a history or log ConfigMap well below the 1 MiB an object may have.
+// Once a write would exceed it the oldest entries are dropped.
+const maxConfigMapDataSize = 768 * 1024
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+type configMapStore struct {
+	kc        client.Client
+	namespace string
+}
+
+// NewConfigMapStore returns a HistoryStore that keeps the state transitions of each workflow in its own ConfigMap.
+// Every transition is written under a separate key, so concurrent writers never overwrite each other. A ConfigMap
+// keeps the newest entries that fit in maxConfigMapDataSize.
+func NewConfigMapStore(kc client.Client, namespace string) HistoryStore {
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	return &configMapStore{kc: kc, namespace: namespace}
+}
+
+func (s *configMapStore) name(workflowID string) string {
+	return configMapName(configMapPrefix, workflowID)
+}
+
+// configMapName returns the ConfigMap of a workflow. An ID that is not a valid name as is gets a hash of it
+// appended, so two IDs that are sanitized or truncated to the same string still get their own ConfigMap.
+func configMapName(prefix, workflowID string) string {
+	base := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(workflowID), "-"), "-")
+	if base == workflowID && len(prefix+base) <= validation.DNS1123SubdomainMaxLength {
+		return prefix + base
+	}
+
+	hasher := fnv.New32a()
+	hasher.Write([]byte(workflowID))
+	suffix := fmt.Sprintf("-%08x", hasher.Sum32())
+	if max := validation.DNS1123SubdomainMaxLength - len(prefix) - len(suffix); len(base) > max {
+		base = strings.TrimRight(base[:max], "-")
+	}
+	return prefix + base + suffix
+}
+
+func (s *configMapStore) Save(ctx context.Context, workflowID string, state StateStatus) error {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%019d.%s", time.Now().UnixNano(), invalidNameChars.ReplaceAllString(strings.ToLower(state.StateName), "-"))
+
+	cm := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      s.name(workflowID),
+			Namespace: s.namespace,
+		},
+	}
+	_, err = cu.CreateOrPatch(ctx, s.kc, cm, func(obj client.Object, createOp bool) client.Object {
+		in := obj.(*core.ConfigMap)
+		if in.Annotations == nil {
+			in.Annotations = map[string]string{}
+		}
+		in.Annotations[workflowIDAnnotationKey] = workflowID
+		if in.Data == nil {
+			in.Data = map[string]string{}
+		}
+		in.Data[key] = string(value)
+		trimData(in.Data, maxConfigMapDataSize)
+		return in
+	})
+	return errors.Wrap(err, "failed to save workflow history")
+}
+
+// trimData drops the oldest entries of data until the rest fits in maxSize, the keys sort by the time they were
+// written. The newest entry is always kept.
+func trimData(data map[string]string, maxSize int) {
+	keys := make([]string, 0, len(data))
+	size := 0
+	for k, v := range data {
+		keys = append(keys, k)
+		size += len(k) + len(v)
+	}
+	sort.Strings(keys)
+	for _, k := range keys[:len(keys)-1] {
+		if size <= maxSize {
+			return
+		}
+		size -= len(k) + len(data[k])
+		delete(data, k)
+	}
+}
+
+func (s *configMapStore) Get(ctx context.Context, workflowID string) ([]StateStatus, error) {
+	cm := &core.ConfigMap{}
+	err := s.kc.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: s.name(workflowID)}, cm)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to get workflow history")
+	}
+
+	keys := make([]string, 0, len(cm.Data))
+	for k := range cm.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	history := make([]StateStatus, 0, len(keys))
+	for _, k := range keys {
+		var state StateStatus
+		if err := json.Unmarshal([]byte(cm.Data[k]), &state); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode workflow history entry %s", k)
+		}
+		history = append(history, state)
+	}
+	return history, nil
+}
+
+// AppendLogs writes each batch of log lines under its own key of the workflow's log ConfigMap
+func (s *configMapStore) AppendLogs(ctx context.Context, workflowID string, lines []LogLine) error {
+	value, err := json.Marshal(lines)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%019d", time.Now().UnixNano())
+
+	cm := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName(logConfigMapPrefix, workflowID),
+			Namespace: s.namespace,
+		},
+	}
+	_, err = cu.CreateOrPatch(ctx, s.kc, cm, func(obj client.Object, createOp bool) client.Object {
+		in := obj.(*core.ConfigMap)
+		if in.Annotations == nil {
+			in.Annotations = map[string]string{}
+		}
+		in.Annotations[workflowIDAnnotationKey] = workflowID
+		if in.Data == nil {
+			in.Data = map[string]string{}
+		}
+		in.Data[key] = string(value)
+		trimData(in.Data, maxConfigMapDataSize)
+		return in
+	})
+	return errors.Wrap(err, "failed to save workflow logs")
+}
+
+func (s *configMapStore) GetLogs(ctx context.Context, workflowID string) ([]LogLine, error) {
+	cm := &core.ConfigMap{}
+	err := s.kc.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: configMapName(logConfigMapPrefix, workflowID)}, cm)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to get workflow logs")
+	}
+
+	keys := make([]string, 0, len(cm.Data))
+	for k := range cm.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var lines []LogLine
+	for _, k := range keys {
+		var batch []LogLine
+		if err := json.Unmarshal([]byte(cm.Data[k]), &batch); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode workflow log entry %s", k)
+		}
+		lines = append(lines, batch...)
+	}
+	return lines, nil
+}
+
+// Delete removes the history and the log ConfigMap of a workflow
+func (s *configMapStore) Delete(ctx context.Context, workflowID string) error {
+	if err := s.deleteConfigMap(ctx, s.name(workflowID)); err != nil {
+		return errors.Wrap(err, "failed to delete workflow history")
+	}
+	return s.DeleteLogs(ctx, workflowID)
+}
+
+// DeleteLogs removes the log ConfigMap of a workflow
+func (s *configMapStore) DeleteLogs(ctx context.Context, workflowID string) error {
+	err := s.deleteConfigMap(ctx, configMapName(logConfigMapPrefix, workflowID))
+	return errors.Wrap(err, "failed to delete workflow logs")
+}
+
+func (s *configMapStore) deleteConfigMap(ctx context.Context, name string) error {
+	cm := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: s.namespace,
+		},
+	}
+	return client.IgnoreNotFound(s.kc.Delete(ctx, cm))
+}
@@ -0,0 +1,148 @@
+package persistence
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type fileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileStore returns a HistoryStore that appends state transitions to one JSON lines file per workflow in dir
+func NewFileStore(dir string) (HistoryStore, error) {
+	if dir == "" {
+		return nil, errors.New("history directory is required for the file history store")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create history directory")
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) path(workflowID string) string {
+	return filepath.Join(s.dir, url.PathEscape(workflowID)+".jsonl")
+}
+
+func (s *fileStore) logPath(workflowID string) string {
+	return filepath.Join(s.dir, url.PathEscape(workflowID)+".logs.jsonl")
+}
+
+func (s *fileStore) Save(ctx context.Context, workflowID string, state StateStatus) error {
+	line, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path(workflowID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open history file")
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+func (s *fileStore) Get(ctx context.Context, workflowID string) ([]StateStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path(workflowID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to open history file")
+	}
+	defer f.Close()
+
+	var history []StateStatus
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var state StateStatus
+		if err := json.Unmarshal(scanner.Bytes(), &state); err != nil {
+			return nil, errors.Wrap(err, "failed to decode history file")
+		}
+		history = append(history, state)
+	}
+	return history, scanner.Err()
+}
+
+func (s *fileStore) AppendLogs(ctx context.Context, workflowID string, lines []LogLine) error {
+	var buf []byte
+	for _, l := range lines {
+		line, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.logPath(workflowID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open log file")
+	}
+	defer f.Close()
+	_, err = f.Write(buf)
+	return err
+}
+
+func (s *fileStore) GetLogs(ctx context.Context, workflowID string) ([]LogLine, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.logPath(workflowID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to open log file")
+	}
+	defer f.Close()
+
+	var lines []LogLine
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var l LogLine
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			return nil, errors.Wrap(err, "failed to decode log file")
+		}
+		lines = append(lines, l)
+	}
+	return lines, scanner.Err()
+}
+
+func (s *fileStore) Delete(ctx context.Context, workflowID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := removeFile(s.path(workflowID)); err != nil {
+		return errors.Wrap(err, "failed to remove history file")
+	}
+	return errors.Wrap(removeFile(s.logPath(workflowID)), "failed to remove log file")
+}
+
+func (s *fileStore) DeleteLogs(ctx context.Context, workflowID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Wrap(removeFile(s.logPath(workflowID)), "failed to remove log file")
+}
+
+// removeFile removes path, a file that is already gone is not an error
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
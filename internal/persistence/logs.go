@@ -0,0 +1,64 @@
+package persistence
+
+import "context"
+
+// LogLine is one line of output of a capi-runner Job. Lines written by the scripts' log() function are split into
+// their fields, any other output is kept in Message only.
+type LogLine struct {
+	Time    string `json:"time,omitempty"`
+	Script  string `json:"script,omitempty"`
+	Level   string `json:"level,omitempty"`
+	Message string `json:"message"`
+	// Pod is the capi-runner pod that wrote the line, a retried Job writes its output from a new pod
+	Pod string `json:"pod,omitempty"`
+	// Line numbers the lines of Pod's output from 1, it tells a line copied twice from one copied once
+	Line int `json:"line,omitempty"`
+}
+
+// AppendLogs adds log lines of a workflow to the configured store
+func AppendLogs(ctx context.Context, workflowID string, lines []LogLine) error {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store.AppendLogs(ctx, workflowID, lines)
+}
+
+// GetLogs returns the stored log lines of a workflow from the configured store, oldest first. A line stored more
+// than once, by two workers that copied the same pod, is returned once.
+func GetLogs(ctx context.Context, workflowID string) ([]LogLine, error) {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	lines, err := store.GetLogs(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	return dedupeLogs(lines), nil
+}
+
+// dedupeLogs keeps the first of the lines with the same pod and line number, lines without a number are all kept
+func dedupeLogs(lines []LogLine) []LogLine {
+	type position struct {
+		pod  string
+		line int
+	}
+	seen := map[position]bool{}
+	kept := lines[:0]
+	for _, l := range lines {
+		if l.Line > 0 {
+			pos := position{pod: l.Pod, line: l.Line}
+			if seen[pos] {
+				continue
+			}
+			seen[pos] = true
+		}
+		kept = append(kept, l)
+	}
+	return kept
+}
+
+// DeleteLogs removes the stored log lines of a workflow from the configured store, so the progress and log tail of
+// the next Job are not mixed with the output of an earlier one
+func DeleteLogs(ctx context.Context, workflowID string) error {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store.DeleteLogs(ctx, workflowID)
+}
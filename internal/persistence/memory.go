@@ -1,6 +1,7 @@
 package persistence
 
 import (
+	"context"
 	"sync"
 )
 
@@ -12,21 +13,64 @@ type StateStatus struct {
 	Data       map[string]interface{} `json:"data,omitempty"`
 }
 
-var (
-	historyStore = make(map[string][]StateStatus)
-	mu           sync.RWMutex
-)
+type memoryStore struct {
+	mu      sync.RWMutex
+	history map[string][]StateStatus
+	logs    map[string][]LogLine
+}
+
+// NewMemoryStore returns a HistoryStore that keeps state transitions in process memory. It is lost on restart and
+// only seen by its own process, so it serves tests and an API and worker that run in one process.
+func NewMemoryStore() HistoryStore {
+	return &memoryStore{
+		history: make(map[string][]StateStatus),
+		logs:    make(map[string][]LogLine),
+	}
+}
 
 // Save persists state transition in memory
-func Save(workflowID string, state StateStatus) {
-	mu.Lock()
-	defer mu.Unlock()
-	historyStore[workflowID] = append(historyStore[workflowID], state)
+func (s *memoryStore) Save(ctx context.Context, workflowID string, state StateStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history[workflowID] = append(s.history[workflowID], state)
+	return nil
 }
 
 // Get returns all state transitions for a workflow
-func Get(workflowID string) []StateStatus {
-	mu.RLock()
-	defer mu.RUnlock()
-	return historyStore[workflowID]
+func (s *memoryStore) Get(ctx context.Context, workflowID string) ([]StateStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]StateStatus(nil), s.history[workflowID]...), nil
+}
+
+// AppendLogs keeps job log lines in memory
+func (s *memoryStore) AppendLogs(ctx context.Context, workflowID string, lines []LogLine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs[workflowID] = append(s.logs[workflowID], lines...)
+	return nil
+}
+
+// GetLogs returns all job log lines for a workflow
+func (s *memoryStore) GetLogs(ctx context.Context, workflowID string) ([]LogLine, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]LogLine(nil), s.logs[workflowID]...), nil
+}
+
+// Delete forgets the state transitions and job logs of a workflow
+func (s *memoryStore) Delete(ctx context.Context, workflowID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.history, workflowID)
+	delete(s.logs, workflowID)
+	return nil
+}
+
+// DeleteLogs forgets the job logs of a workflow
+func (s *memoryStore) DeleteLogs(ctx context.Context, workflowID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.logs, workflowID)
+	return nil
 }
@@ -0,0 +1,92 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+const (
+	StoreMemory    = "memory"
+	StoreFile      = "file"
+	StoreConfigMap = "configmap"
+)
+
+// HistoryStore persists the state transitions and job logs of workflows
+type HistoryStore interface {
+	Save(ctx context.Context, workflowID string, state StateStatus) error
+	Get(ctx context.Context, workflowID string) ([]StateStatus, error)
+	AppendLogs(ctx context.Context, workflowID string, lines []LogLine) error
+	GetLogs(ctx context.Context, workflowID string) ([]LogLine, error)
+	// Delete removes the state transitions and job logs of a workflow
+	Delete(ctx context.Context, workflowID string) error
+	// DeleteLogs removes only the job logs of a workflow
+	DeleteLogs(ctx context.Context, workflowID string) error
+}
+
+// Options selects and configures a HistoryStore
+type Options struct {
+	Kind      string
+	Dir       string
+	Namespace string
+}
+
+var (
+	store   = NewMemoryStore()
+	storeMu sync.RWMutex
+)
+
+// NewStore builds the HistoryStore described by opts, the ConfigMap store unless opts names another one. The API
+// reads what the worker writes, so only a store both processes reach serves them both.
+func NewStore(opts Options) (HistoryStore, error) {
+	switch opts.Kind {
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StoreFile:
+		return NewFileStore(opts.Dir)
+	case "", StoreConfigMap:
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return nil, err
+		}
+		kc, err := client.New(cfg, client.Options{})
+		if err != nil {
+			return nil, err
+		}
+		return NewConfigMapStore(kc, opts.Namespace), nil
+	default:
+		return nil, fmt.Errorf("unknown history store %q", opts.Kind)
+	}
+}
+
+// SetStore replaces the HistoryStore used by Save and Get
+func SetStore(s HistoryStore) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	store = s
+}
+
+// Save persists state transition in the configured store
+func Save(ctx context.Context, workflowID string, state StateStatus) error {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store.Save(ctx, workflowID, state)
+}
+
+// Get returns all state transitions for a workflow from the configured store
+func Get(ctx context.Context, workflowID string) ([]StateStatus, error) {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store.Get(ctx, workflowID)
+}
+
+// Delete removes everything the configured store keeps for a workflow. The store is keyed by workflow ID, which a
+// new run of the workflow reuses, so a new run calls it before it reports its first state.
+func Delete(ctx context.Context, workflowID string) error {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store.Delete(ctx, workflowID)
+}
@@ -0,0 +1,154 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		store HistoryStore
+	}{
+		{name: StoreMemory, store: NewMemoryStore()},
+		{name: StoreFile, store: fileStore},
+	}
+
+	history := []StateStatus{
+		{WorkflowID: "kubevirt-1-demo", StateName: "createNamespaceState", Status: "success", Data: map[string]interface{}{"nsname": "demo-abc123"}},
+		{WorkflowID: "kubevirt-1-demo", StateName: "createJobState", Status: "failed", Data: map[string]interface{}{"error": "no image"}},
+	}
+	logs := []LogLine{
+		{Time: "2026/01/02 03:04:05", Script: "create", Level: "INFO", Message: "applying cluster", Pod: "capi-runner-x"},
+		{Message: "plain output", Pod: "capi-runner-x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, state := range history {
+				if err := tt.store.Save(ctx, "kubevirt-1-demo", state); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+			if err := tt.store.AppendLogs(ctx, "kubevirt-1-demo", logs[:1]); err != nil {
+				t.Fatalf("AppendLogs() error = %v", err)
+			}
+			if err := tt.store.AppendLogs(ctx, "kubevirt-1-demo", logs[1:]); err != nil {
+				t.Fatalf("AppendLogs() error = %v", err)
+			}
+
+			gotHistory, err := tt.store.Get(ctx, "kubevirt-1-demo")
+			if err != nil || !reflect.DeepEqual(gotHistory, history) {
+				t.Errorf("Get() = %v, %v, want %v", gotHistory, err, history)
+			}
+			gotLogs, err := tt.store.GetLogs(ctx, "kubevirt-1-demo")
+			if err != nil || !reflect.DeepEqual(gotLogs, logs) {
+				t.Errorf("GetLogs() = %v, %v, want %v", gotLogs, err, logs)
+			}
+
+			// the caller owns what it read, changing it must not change the history of the store
+			gotHistory[0].Status = "changed"
+			if again, _ := tt.store.Get(ctx, "kubevirt-1-demo"); again[0].Status != history[0].Status {
+				t.Errorf("Get() shares its history with the caller, status changed to %q", again[0].Status)
+			}
+
+			gotHistory, err = tt.store.Get(ctx, "kubevirt-1-other")
+			if err != nil || len(gotHistory) != 0 {
+				t.Errorf("Get() of an unknown workflow = %v, %v, want nothing", gotHistory, err)
+			}
+			gotLogs, err = tt.store.GetLogs(ctx, "kubevirt-1-other")
+			if err != nil || len(gotLogs) != 0 {
+				t.Errorf("GetLogs() of an unknown workflow = %v, %v, want nothing", gotLogs, err)
+			}
+
+			if err := tt.store.DeleteLogs(ctx, "kubevirt-1-demo"); err != nil {
+				t.Fatalf("DeleteLogs() error = %v", err)
+			}
+			gotLogs, err = tt.store.GetLogs(ctx, "kubevirt-1-demo")
+			if err != nil || len(gotLogs) != 0 {
+				t.Errorf("GetLogs() after DeleteLogs() = %v, %v, want nothing", gotLogs, err)
+			}
+			gotHistory, err = tt.store.Get(ctx, "kubevirt-1-demo")
+			if err != nil || len(gotHistory) != len(history) {
+				t.Errorf("Get() after DeleteLogs() = %v, %v, want %v", gotHistory, err, history)
+			}
+
+			if err := tt.store.AppendLogs(ctx, "kubevirt-1-demo", logs); err != nil {
+				t.Fatalf("AppendLogs() error = %v", err)
+			}
+			if err := tt.store.Delete(ctx, "kubevirt-1-demo"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			gotHistory, err = tt.store.Get(ctx, "kubevirt-1-demo")
+			if err != nil || len(gotHistory) != 0 {
+				t.Errorf("Get() after Delete() = %v, %v, want nothing", gotHistory, err)
+			}
+			gotLogs, err = tt.store.GetLogs(ctx, "kubevirt-1-demo")
+			if err != nil || len(gotLogs) != 0 {
+				t.Errorf("GetLogs() after Delete() = %v, %v, want nothing", gotLogs, err)
+			}
+			if err := tt.store.Delete(ctx, "kubevirt-1-other"); err != nil {
+				t.Errorf("Delete() of an unknown workflow error = %v", err)
+			}
+		})
+	}
+}
+
+func TestTrimData(t *testing.T) {
+	entry := strings.Repeat("x", 90)
+	tests := []struct {
+		name     string
+		entries  int
+		maxSize  int
+		wantKeys []string
+	}{
+		{name: "within the limit", entries: 3, maxSize: 1000, wantKeys: []string{"0", "1", "2"}},
+		{name: "oldest dropped", entries: 5, maxSize: 300, wantKeys: []string{"2", "3", "4"}},
+		{name: "newest kept", entries: 2, maxSize: 10, wantKeys: []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]string{}
+			for i := 0; i < tt.entries; i++ {
+				// single digit keys sort by age, like the zero padded keys of the ConfigMap store
+				data[fmt.Sprint(i)] = entry
+			}
+			trimData(data, tt.maxSize)
+			var got []string
+			for i := 0; i < tt.entries; i++ {
+				if _, ok := data[fmt.Sprint(i)]; ok {
+					got = append(got, fmt.Sprint(i))
+				}
+			}
+			if !reflect.DeepEqual(got, tt.wantKeys) {
+				t.Errorf("trimData() kept %v, want %v", got, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestDedupeLogs(t *testing.T) {
+	lines := []LogLine{
+		{Message: "a", Pod: "capi-runner-1", Line: 1},
+		{Message: "b", Pod: "capi-runner-1", Line: 2},
+		// a second worker copied the same pod
+		{Message: "a", Pod: "capi-runner-1", Line: 1},
+		{Message: "a", Pod: "capi-runner-2", Line: 1},
+		// lines without a number are never dropped
+		{Message: "c"},
+		{Message: "c"},
+	}
+	want := []LogLine{lines[0], lines[1], lines[3], lines[4], lines[5]}
+	if got := dedupeLogs(append([]LogLine(nil), lines...)); !reflect.DeepEqual(got, want) {
+		t.Errorf("dedupeLogs() = %v, want %v", got, want)
+	}
+}
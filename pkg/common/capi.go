@@ -0,0 +1,406 @@
+package common
+
+import (
+	goctx "context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	clusterNameLabel           = "cluster.x-k8s.io/cluster-name"
+	machineDeploymentNameLabel = "cluster.x-k8s.io/deployment-name"
+	// clonedForAnnotation names the object a KubevirtMachineTemplate was cloned for by cloneMachineTemplate
+	clonedForAnnotation = "iwf.cadence.dev/cloned-for"
+)
+
+var (
+	machineDeploymentGVK           = schema.GroupVersionKind{Group: "cluster.x-k8s.io", Version: "v1beta1", Kind: "MachineDeployment"}
+	machineDeploymentListGVK       = schema.GroupVersionKind{Group: "cluster.x-k8s.io", Version: "v1beta1", Kind: "MachineDeploymentList"}
+	machineSetListGVK              = schema.GroupVersionKind{Group: "cluster.x-k8s.io", Version: "v1beta1", Kind: "MachineSetList"}
+	machineListGVK                 = schema.GroupVersionKind{Group: "cluster.x-k8s.io", Version: "v1beta1", Kind: "MachineList"}
+	kubevirtMachineTemplateGVK     = schema.GroupVersionKind{Group: "infrastructure.cluster.x-k8s.io", Version: "v1alpha1", Kind: "KubevirtMachineTemplate"}
+	kubevirtMachineTemplateListGVK = schema.GroupVersionKind{Group: "infrastructure.cluster.x-k8s.io", Version: "v1alpha1", Kind: "KubevirtMachineTemplateList"}
+)
+
+func vmDomainPath(fields ...string) []string {
+	return append([]string{"spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain"}, fields...)
+}
+
+// ScaleMachineDeployment applies the machine count and size of cfg to the MachineDeployment of the pool.
+// KubevirtMachineTemplates are immutable, so a size change creates a new template and rolls the pool onto it. The
+// replaced template is still needed to delete the old machines, DeleteUnusedMachineTemplates removes it once the
+// rollout finished.
+func ScaleMachineDeployment(ctx goctx.Context, kc client.Client, cfg ClusterScaleConfig) error {
+	md := &unstructured.Unstructured{}
+	md.SetGroupVersionKind(machineDeploymentGVK)
+	key := types.NamespacedName{Namespace: cfg.InfraNamespace, Name: cfg.MachineDeploymentName()}
+	if err := kc.Get(ctx, key, md); err != nil {
+		return errors.Wrapf(err, "failed to get machine deployment %s", key)
+	}
+
+	patch := client.MergeFrom(md.DeepCopy())
+	if cfg.MachineCount != nil {
+		if err := unstructured.SetNestedField(md.Object, int64(*cfg.MachineCount), "spec", "replicas"); err != nil {
+			return err
+		}
+	}
+	if cfg.CPU > 0 || cfg.Memory > 0 {
+		name, err := createResizedMachineTemplate(ctx, kc, md, cfg)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(md.Object, name, "spec", "template", "spec", "infrastructureRef", "name"); err != nil {
+			return err
+		}
+	}
+	return errors.Wrapf(kc.Patch(ctx, md, patch), "failed to patch machine deployment %s", key)
+}
+
+func createResizedMachineTemplate(ctx goctx.Context, kc client.Client, md *unstructured.Unstructured, cfg ClusterScaleConfig) (string, error) {
+	refName, found, err := unstructured.NestedString(md.Object, "spec", "template", "spec", "infrastructureRef", "name")
+	if err != nil || !found {
+		return "", fmt.Errorf("machine deployment %s has no infrastructure template", md.GetName())
+	}
+
+	return cloneMachineTemplate(ctx, kc, md.GetNamespace(), refName, cfg.MachineDeploymentName(), func(tmpl *unstructured.Unstructured) error {
+		if cfg.CPU > 0 {
+			if err := unstructured.SetNestedField(tmpl.Object, int64(cfg.CPU), vmDomainPath("cpu", "cores")...); err != nil {
+				return err
+			}
+		}
+		if cfg.Memory > 0 {
+			return unstructured.SetNestedField(tmpl.Object, fmt.Sprintf("%dGi", cfg.Memory), vmDomainPath("memory", "guest")...)
+		}
+		return nil
+	})
+}
+
+// cloneMachineTemplate creates a modified copy of a KubevirtMachineTemplate and returns its name. The copy is named
+// after prefix and a hash of its spec, so a retried call finds the template of the first call instead of adding one.
+func cloneMachineTemplate(ctx goctx.Context, kc client.Client, namespace, refName, prefix string, mutate func(tmpl *unstructured.Unstructured) error) (string, error) {
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(kubevirtMachineTemplateGVK)
+	if err := kc.Get(ctx, types.NamespacedName{Namespace: namespace, Name: refName}, current); err != nil {
+		return "", errors.Wrapf(err, "failed to get machine template %s", refName)
+	}
+
+	tmpl := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": runtime.DeepCopyJSONValue(current.Object["spec"]),
+	}}
+	tmpl.SetGroupVersionKind(kubevirtMachineTemplateGVK)
+	tmpl.SetNamespace(namespace)
+	tmpl.SetLabels(current.GetLabels())
+	tmpl.SetAnnotations(map[string]string{clonedForAnnotation: prefix})
+
+	if err := mutate(tmpl); err != nil {
+		return "", err
+	}
+	spec, err := json.Marshal(tmpl.Object["spec"])
+	if err != nil {
+		return "", err
+	}
+	hasher := fnv.New32a()
+	hasher.Write(spec)
+	tmpl.SetName(fmt.Sprintf("%s-%s", prefix, rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))))
+
+	if err := kc.Create(ctx, tmpl); err != nil && !kerr.IsAlreadyExists(err) {
+		return "", errors.Wrapf(err, "failed to create machine template %s", tmpl.GetName())
+	}
+	return tmpl.GetName(), nil
+}
+
+// DeleteUnusedMachineTemplates deletes the KubevirtMachineTemplates cloned for a MachineDeployment that neither the
+// MachineDeployment nor any of its MachineSets reference. It is called once a rollout finished, an old MachineSet
+// needs its template until its machines are gone; a template that is still referenced is kept for a later call.
+func DeleteUnusedMachineTemplates(ctx goctx.Context, kc client.Client, mdKey types.NamespacedName) error {
+	md := &unstructured.Unstructured{}
+	md.SetGroupVersionKind(machineDeploymentGVK)
+	if err := kc.Get(ctx, mdKey, md); err != nil {
+		return errors.Wrapf(err, "failed to get machine deployment %s", mdKey)
+	}
+	inUse := sets.New[string]()
+	if name, found, _ := unstructured.NestedString(md.Object, "spec", "template", "spec", "infrastructureRef", "name"); found {
+		inUse.Insert(name)
+	}
+	machineSets := &unstructured.UnstructuredList{}
+	machineSets.SetGroupVersionKind(machineSetListGVK)
+	if err := kc.List(ctx, machineSets, client.InNamespace(mdKey.Namespace), client.MatchingLabels{
+		machineDeploymentNameLabel: mdKey.Name,
+	}); err != nil {
+		return errors.Wrap(err, "failed to list machine sets")
+	}
+	for _, ms := range machineSets.Items {
+		if name, found, _ := unstructured.NestedString(ms.Object, "spec", "template", "spec", "infrastructureRef", "name"); found {
+			inUse.Insert(name)
+		}
+	}
+
+	return deleteClonedMachineTemplates(ctx, kc, mdKey.Namespace, mdKey.Name, inUse)
+}
+
+// DeleteUnusedControlPlaneTemplates deletes the KubevirtMachineTemplates UpgradeControlPlane cloned for a
+// KubeadmControlPlane that it no longer references. It is called once the control plane is upgraded, by then
+// no machine of the replaced template is left. A KamajiControlPlane has no machine templates.
+func DeleteUnusedControlPlaneTemplates(ctx goctx.Context, kc client.Client, cp *unstructured.Unstructured) error {
+	if cp.GetKind() != "KubeadmControlPlane" {
+		return nil
+	}
+	inUse := sets.New[string]()
+	if name, found, _ := unstructured.NestedString(cp.Object, "spec", "machineTemplate", "infrastructureRef", "name"); found {
+		inUse.Insert(name)
+	}
+	return deleteClonedMachineTemplates(ctx, kc, cp.GetNamespace(), cp.GetName(), inUse)
+}
+
+// deleteClonedMachineTemplates deletes the KubevirtMachineTemplates cloned for the named owner that are not in inUse
+func deleteClonedMachineTemplates(ctx goctx.Context, kc client.Client, namespace, clonedFor string, inUse sets.Set[string]) error {
+	templates := &unstructured.UnstructuredList{}
+	templates.SetGroupVersionKind(kubevirtMachineTemplateListGVK)
+	if err := kc.List(ctx, templates, client.InNamespace(namespace)); err != nil {
+		return errors.Wrap(err, "failed to list machine templates")
+	}
+	for i := range templates.Items {
+		tmpl := &templates.Items[i]
+		if tmpl.GetAnnotations()[clonedForAnnotation] != clonedFor || inUse.Has(tmpl.GetName()) {
+			continue
+		}
+		log.Printf("Deleting unused machine template %s/%s", tmpl.GetNamespace(), tmpl.GetName())
+		if err := kc.Delete(ctx, tmpl); err != nil && !kerr.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete machine template %s", tmpl.GetName())
+		}
+	}
+	return nil
+}
+
+// setNodeVMImage points every capk container disk of the machine template to the image of the given version
+func setNodeVMImage(tmpl *unstructured.Unstructured, kubernetesVersion string) error {
+	path := []string{"spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "volumes"}
+	volumes, found, err := unstructured.NestedSlice(tmpl.Object, path...)
+	if err != nil || !found {
+		return fmt.Errorf("machine template %s has no volumes", tmpl.GetName())
+	}
+	for _, v := range volumes {
+		vol, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		image, _, _ := unstructured.NestedString(vol, "containerDisk", "image")
+		if strings.HasPrefix(image, nodeVMImageRepository) {
+			if err := unstructured.SetNestedField(vol, NodeVMImage(kubernetesVersion), "containerDisk", "image"); err != nil {
+				return err
+			}
+		}
+	}
+	return unstructured.SetNestedSlice(tmpl.Object, volumes, path...)
+}
+
+// DeleteCAPICluster deletes a CAPI Cluster and so everything CAPI created for it, a missing Cluster or CAPI
+// installation is not an error
+func DeleteCAPICluster(ctx goctx.Context, kc client.Client, clusterKey types.NamespacedName) error {
+	cluster := &unstructured.Unstructured{}
+	cluster.SetGroupVersionKind(capiClusterGVK)
+	cluster.SetNamespace(clusterKey.Namespace)
+	cluster.SetName(clusterKey.Name)
+	err := kc.Delete(ctx, cluster)
+	if err != nil && !kerr.IsNotFound(err) && !meta.IsNoMatchError(err) {
+		return errors.Wrapf(err, "failed to delete cluster %s", clusterKey)
+	}
+	return nil
+}
+
+// GetControlPlane returns the control plane object (KubeadmControlPlane or KamajiControlPlane) of a CAPI Cluster
+func GetControlPlane(ctx goctx.Context, kc client.Client, clusterKey types.NamespacedName) (*unstructured.Unstructured, error) {
+	cluster := &unstructured.Unstructured{}
+	cluster.SetGroupVersionKind(capiClusterGVK)
+	if err := kc.Get(ctx, clusterKey, cluster); err != nil {
+		return nil, errors.Wrapf(err, "failed to get cluster %s", clusterKey)
+	}
+	ref, found, err := unstructured.NestedStringMap(cluster.Object, "spec", "controlPlaneRef")
+	if err != nil || !found {
+		return nil, fmt.Errorf("cluster %s has no control plane reference", clusterKey)
+	}
+
+	cp := &unstructured.Unstructured{}
+	cp.SetAPIVersion(ref["apiVersion"])
+	cp.SetKind(ref["kind"])
+	if err := kc.Get(ctx, types.NamespacedName{Namespace: clusterKey.Namespace, Name: ref["name"]}, cp); err != nil {
+		return nil, errors.Wrapf(err, "failed to get %s %s", ref["kind"], ref["name"])
+	}
+	return cp, nil
+}
+
+// UpgradeControlPlane moves the control plane to the given Kubernetes version. Machines of a
+// KubeadmControlPlane are rolled onto a machine template booting the matching image,
+// a KamajiControlPlane runs as pods on the hub and only needs its version bumped.
+// DeleteUnusedControlPlaneTemplates removes the replaced template once the rollout finished.
+func UpgradeControlPlane(ctx goctx.Context, kc client.Client, cp *unstructured.Unstructured, kubernetesVersion string) error {
+	patch := client.MergeFrom(cp.DeepCopy())
+	if err := unstructured.SetNestedField(cp.Object, "v"+strings.TrimPrefix(kubernetesVersion, "v"), "spec", "version"); err != nil {
+		return err
+	}
+	if cp.GetKind() == "KubeadmControlPlane" {
+		refName, found, err := unstructured.NestedString(cp.Object, "spec", "machineTemplate", "infrastructureRef", "name")
+		if err != nil || !found {
+			return fmt.Errorf("control plane %s has no infrastructure template", cp.GetName())
+		}
+		name, err := cloneMachineTemplate(ctx, kc, cp.GetNamespace(), refName, cp.GetName(), func(tmpl *unstructured.Unstructured) error {
+			return setNodeVMImage(tmpl, kubernetesVersion)
+		})
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(cp.Object, name, "spec", "machineTemplate", "infrastructureRef", "name"); err != nil {
+			return err
+		}
+	}
+	return errors.Wrapf(kc.Patch(ctx, cp, patch), "failed to patch control plane %s", cp.GetName())
+}
+
+// IsControlPlaneUpgraded reports whether the control plane runs the given version and is ready, for control
+// planes with machines all of them must be up to date.
+func IsControlPlaneUpgraded(cp *unstructured.Unstructured, kubernetesVersion string) bool {
+	observed, found, _ := unstructured.NestedInt64(cp.Object, "status", "observedGeneration")
+	if found && observed < cp.GetGeneration() {
+		return false
+	}
+	current, _, _ := unstructured.NestedString(cp.Object, "status", "version")
+	ready, _, _ := unstructured.NestedBool(cp.Object, "status", "ready")
+	if current != "v"+strings.TrimPrefix(kubernetesVersion, "v") || !ready {
+		return false
+	}
+	if replicas, found, _ := unstructured.NestedInt64(cp.Object, "spec", "replicas"); found && cp.GetKind() == "KubeadmControlPlane" {
+		updated, _, _ := unstructured.NestedInt64(cp.Object, "status", "updatedReplicas")
+		total, _, _ := unstructured.NestedInt64(cp.Object, "status", "replicas")
+		return updated == replicas && total == replicas
+	}
+	return true
+}
+
+// PauseCluster sets spec.paused of a CAPI Cluster. The CAPI controllers leave a paused cluster alone, so a rollout
+// of its machines stops where it is until the cluster is unpaused.
+func PauseCluster(ctx goctx.Context, kc client.Client, clusterKey types.NamespacedName, paused bool) error {
+	cluster := &unstructured.Unstructured{}
+	cluster.SetGroupVersionKind(capiClusterGVK)
+	if err := kc.Get(ctx, clusterKey, cluster); err != nil {
+		return errors.Wrapf(err, "failed to get cluster %s", clusterKey)
+	}
+	patch := client.MergeFrom(cluster.DeepCopy())
+	if err := unstructured.SetNestedField(cluster.Object, paused, "spec", "paused"); err != nil {
+		return err
+	}
+	return errors.Wrapf(kc.Patch(ctx, cluster, patch), "failed to patch cluster %s", clusterKey)
+}
+
+// NextMachineDeploymentToUpgrade returns the name of the first MachineDeployment of the cluster not yet on the
+// given version, or an empty string when all of them are.
+func NextMachineDeploymentToUpgrade(ctx goctx.Context, kc client.Client, clusterKey types.NamespacedName, kubernetesVersion string) (string, error) {
+	want := "v" + strings.TrimPrefix(kubernetesVersion, "v")
+	mds := &unstructured.UnstructuredList{}
+	mds.SetGroupVersionKind(machineDeploymentListGVK)
+	if err := kc.List(ctx, mds, client.InNamespace(clusterKey.Namespace), client.MatchingLabels{
+		clusterNameLabel: clusterKey.Name,
+	}); err != nil {
+		return "", errors.Wrap(err, "failed to list machine deployments")
+	}
+	sort.Slice(mds.Items, func(i, j int) bool {
+		return mds.Items[i].GetName() < mds.Items[j].GetName()
+	})
+	for _, md := range mds.Items {
+		current, _, _ := unstructured.NestedString(md.Object, "spec", "template", "spec", "version")
+		if current != want {
+			return md.GetName(), nil
+		}
+	}
+	return "", nil
+}
+
+// UpgradeMachineDeployment rolls the machines of a MachineDeployment to the given Kubernetes version and its image
+func UpgradeMachineDeployment(ctx goctx.Context, kc client.Client, namespacedName types.NamespacedName, kubernetesVersion string) error {
+	md := &unstructured.Unstructured{}
+	md.SetGroupVersionKind(machineDeploymentGVK)
+	if err := kc.Get(ctx, namespacedName, md); err != nil {
+		return errors.Wrapf(err, "failed to get machine deployment %s", namespacedName)
+	}
+	refName, found, err := unstructured.NestedString(md.Object, "spec", "template", "spec", "infrastructureRef", "name")
+	if err != nil || !found {
+		return fmt.Errorf("machine deployment %s has no infrastructure template", md.GetName())
+	}
+
+	name, err := cloneMachineTemplate(ctx, kc, md.GetNamespace(), refName, md.GetName(), func(tmpl *unstructured.Unstructured) error {
+		return setNodeVMImage(tmpl, kubernetesVersion)
+	})
+	if err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(md.DeepCopy())
+	if err := unstructured.SetNestedField(md.Object, "v"+strings.TrimPrefix(kubernetesVersion, "v"), "spec", "template", "spec", "version"); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(md.Object, name, "spec", "template", "spec", "infrastructureRef", "name"); err != nil {
+		return err
+	}
+	return errors.Wrapf(kc.Patch(ctx, md, patch), "failed to patch machine deployment %s", namespacedName)
+}
+
+// IsMachineDeploymentReady reports whether every Machine of the MachineDeployment runs the latest template and
+// is Ready, and no machines of older revisions are left.
+func IsMachineDeploymentReady(ctx goctx.Context, kc client.Client, namespacedName types.NamespacedName) (bool, error) {
+	md := &unstructured.Unstructured{}
+	md.SetGroupVersionKind(machineDeploymentGVK)
+	if err := kc.Get(ctx, namespacedName, md); err != nil {
+		return false, errors.Wrapf(err, "failed to get machine deployment %s", namespacedName)
+	}
+	observed, _, _ := unstructured.NestedInt64(md.Object, "status", "observedGeneration")
+	if observed < md.GetGeneration() {
+		return false, nil
+	}
+	desired, _, _ := unstructured.NestedInt64(md.Object, "spec", "replicas")
+	updated, _, _ := unstructured.NestedInt64(md.Object, "status", "updatedReplicas")
+	if updated != desired {
+		return false, nil
+	}
+
+	machines := &unstructured.UnstructuredList{}
+	machines.SetGroupVersionKind(machineListGVK)
+	if err := kc.List(ctx, machines, client.InNamespace(namespacedName.Namespace), client.MatchingLabels{
+		machineDeploymentNameLabel: namespacedName.Name,
+	}); err != nil {
+		return false, errors.Wrapf(err, "failed to list machines of %s", namespacedName)
+	}
+	if int64(len(machines.Items)) != desired {
+		return false, nil
+	}
+	for _, m := range machines.Items {
+		if !isConditionTrue(&m, "Ready") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func isConditionTrue(obj *unstructured.Unstructured, conditionType string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if ok && cond["type"] == conditionType {
+			return cond["status"] == "True"
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package common
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func machineTemplate(name, clonedFor string) *unstructured.Unstructured {
+	tmpl := &unstructured.Unstructured{}
+	tmpl.SetGroupVersionKind(kubevirtMachineTemplateGVK)
+	tmpl.SetNamespace("demo")
+	tmpl.SetName(name)
+	if clonedFor != "" {
+		tmpl.SetAnnotations(map[string]string{clonedForAnnotation: clonedFor})
+	}
+	return tmpl
+}
+
+func controlPlane(kind, templateName string) *unstructured.Unstructured {
+	cp := &unstructured.Unstructured{}
+	cp.SetAPIVersion("controlplane.cluster.x-k8s.io/v1beta1")
+	cp.SetKind(kind)
+	cp.SetNamespace("demo")
+	cp.SetName("demo-control-plane")
+	if templateName != "" {
+		_ = unstructured.SetNestedField(cp.Object, templateName, "spec", "machineTemplate", "infrastructureRef", "name")
+	}
+	return cp
+}
+
+func TestDeleteUnusedControlPlaneTemplates(t *testing.T) {
+	templates := []client.Object{
+		machineTemplate("demo-control-plane", ""),
+		machineTemplate("demo-control-plane-old", "demo-control-plane"),
+		machineTemplate("demo-control-plane-new", "demo-control-plane"),
+		machineTemplate("demo-md-0-resized", "demo-md-0"),
+	}
+	tests := []struct {
+		name string
+		cp   *unstructured.Unstructured
+		want []string
+	}{
+		{
+			name: "replaced template of a kubeadm control plane",
+			cp:   controlPlane("KubeadmControlPlane", "demo-control-plane-new"),
+			want: []string{"demo-control-plane", "demo-control-plane-new", "demo-md-0-resized"},
+		},
+		{
+			name: "kamaji control plane",
+			cp:   controlPlane("KamajiControlPlane", ""),
+			want: []string{"demo-control-plane", "demo-control-plane-new", "demo-control-plane-old", "demo-md-0-resized"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := fake.NewClientBuilder().WithObjects(templates...).Build()
+			ctx := context.Background()
+			if err := DeleteUnusedControlPlaneTemplates(ctx, kc, tt.cp); err != nil {
+				t.Fatalf("DeleteUnusedControlPlaneTemplates() error = %v", err)
+			}
+
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(kubevirtMachineTemplateListGVK)
+			if err := kc.List(ctx, list); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, tmpl := range list.Items {
+				got = append(got, tmpl.GetName())
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("templates left = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsControlPlaneUpgraded(t *testing.T) {
+	status := func(kind string, version string, ready bool, updated int64) *unstructured.Unstructured {
+		cp := controlPlane(kind, "")
+		cp.SetGeneration(2)
+		_ = unstructured.SetNestedField(cp.Object, int64(3), "spec", "replicas")
+		_ = unstructured.SetNestedField(cp.Object, int64(2), "status", "observedGeneration")
+		_ = unstructured.SetNestedField(cp.Object, version, "status", "version")
+		_ = unstructured.SetNestedField(cp.Object, ready, "status", "ready")
+		_ = unstructured.SetNestedField(cp.Object, updated, "status", "updatedReplicas")
+		_ = unstructured.SetNestedField(cp.Object, int64(3), "status", "replicas")
+		return cp
+	}
+	tests := []struct {
+		name string
+		cp   *unstructured.Unstructured
+		want bool
+	}{
+		{name: "rolled out", cp: status("KubeadmControlPlane", "v1.30.1", true, 3), want: true},
+		{name: "old version", cp: status("KubeadmControlPlane", "v1.29.4", true, 3), want: false},
+		{name: "not ready", cp: status("KubeadmControlPlane", "v1.30.1", false, 3), want: false},
+		{name: "machines left to roll", cp: status("KubeadmControlPlane", "v1.30.1", true, 1), want: false},
+		{name: "kamaji control plane without machines", cp: status("KamajiControlPlane", "v1.30.1", true, 0), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsControlPlaneUpgraded(tt.cp, "1.30.1"); got != tt.want {
+				t.Errorf("IsControlPlaneUpgraded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
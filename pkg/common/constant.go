@@ -7,4 +7,6 @@ const (
 	RetryTimeout  = 1 * time.Hour
 	pullInterval  = 5 * time.Second
 	waitTimeout   = 10 * time.Minute
+	// ClusterDeletionTimeout bounds how long the removal of a CAPI Cluster and its infra namespace is waited for
+	ClusterDeletionTimeout = 10 * time.Minute
 )
@@ -5,6 +5,8 @@ import (
 )
 
 const (
+	CredentialGroup        = "cloud.bytebuilders.dev"
+	CredentialVersion      = "v1alpha1"
 	ResourceKindCredential = "Credential"
 	ResourceCredential     = "credential"
 	ResourceCredentials    = "credentials"
@@ -2,11 +2,20 @@ package common
 
 import (
 	goctx "context"
+	"fmt"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
@@ -20,6 +29,15 @@ import (
 
 var scheme = runtime.NewScheme()
 
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+}
+
+var (
+	capiClusterGVK = schema.GroupVersionKind{Group: "cluster.x-k8s.io", Version: "v1beta1", Kind: "Cluster"}
+	namespaceGVK   = schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}
+)
+
 func GetCAPIKubevirtKubeconfig(ctx goctx.Context, kubeconfig string, namespacedName types.NamespacedName) (string, error) {
 	kubeconfigBytes := []byte(kubeconfig)
 	apiConfig, err := clientcmd.Load(kubeconfigBytes)
@@ -49,6 +67,61 @@ func GetCAPIKubevirtKubeconfig(ctx goctx.Context, kubeconfig string, namespacedN
 	return string(CAPIKubeconfig), err
 }
 
+// namespaceSuffixLength is the length of the random suffix of a runner namespace
+const namespaceSuffixLength = 6
+
+// MaxClusterNameLength leaves room for the longest suffix a runner namespace adds to the cluster name, the one
+// of DeleteNamespaceName, within the 63 characters of a namespace name
+const MaxClusterNameLength = validation.DNS1123LabelMaxLength - len("-delete-") - namespaceSuffixLength
+
+// RunnerNamespaceName returns a new name for the namespace a capi-runner Job of the cluster runs in
+func RunnerNamespaceName(clusterName string) string {
+	return RunnerNamespaceNameWithSuffix(clusterName, rand.String(namespaceSuffixLength))
+}
+
+// RunnerNamespaceNameWithSuffix returns the name of the runner namespace of the cluster with the given suffix in
+// place of the random one
+func RunnerNamespaceNameWithSuffix(clusterName, suffix string) string {
+	return fmt.Sprintf("%s-%s", clusterName, suffix)
+}
+
+// DeleteNamespaceName returns a new name for the namespace the deletion Job of the cluster runs in
+func DeleteNamespaceName(clusterName string) string {
+	return fmt.Sprintf("%s-delete-%s", clusterName, rand.String(namespaceSuffixLength))
+}
+
+// RotateCAPIKubeconfig deletes the kubeconfig secret of a CAPI cluster so the control plane provider issues a
+// new one, and returns the regenerated kubeconfig.
+func RotateCAPIKubeconfig(ctx goctx.Context, kubeconfig string, namespacedName types.NamespacedName) (string, error) {
+	kc, err := GetHubClient(kubeconfig)
+	if err != nil {
+		return "", err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      namespacedName.Name,
+			Namespace: namespacedName.Namespace,
+		},
+	}
+	if err := kc.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+		return "", err
+	}
+	return GetCAPIKubevirtKubeconfig(ctx, kubeconfig, namespacedName)
+}
+
+// GetHubClient returns a client for the cluster the given kubeconfig points to
+func GetHubClient(kubeconfig string) (client.Client, error) {
+	apiConfig, err := clientcmd.Load([]byte(kubeconfig))
+	if err != nil {
+		return nil, err
+	}
+	restConfig, err := getRestConfig(apiConfig)
+	if err != nil {
+		return nil, err
+	}
+	return GetNewRuntimeClient(restConfig)
+}
+
 func getRestConfig(apiConfig *clientcmdapi.Config) (*rest.Config, error) {
 	if apiConfig == nil {
 		return controllerruntime.GetConfig()
@@ -99,3 +172,27 @@ func WaitForSecretToBeCreated(kc runtimeclient.Client, namespacedName types.Name
 	}
 	return &secret, nil
 }
+
+// IsCAPIClusterDeleted reports whether both the CAPI Cluster object and its infra namespace are gone from the
+// cluster the given kubeconfig points to.
+func IsCAPIClusterDeleted(ctx goctx.Context, kubeconfig string, namespacedName types.NamespacedName) (bool, error) {
+	kc, err := GetHubClient(kubeconfig)
+	if err != nil {
+		return false, err
+	}
+	clusterGone, err := isObjectGone(ctx, kc, capiClusterGVK, namespacedName)
+	if err != nil || !clusterGone {
+		return false, err
+	}
+	return isObjectGone(ctx, kc, namespaceGVK, types.NamespacedName{Name: namespacedName.Namespace})
+}
+
+func isObjectGone(ctx goctx.Context, kc runtimeclient.Client, gvk schema.GroupVersionKind, namespacedName types.NamespacedName) (bool, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	err := kc.Get(ctx, namespacedName, obj)
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return true, nil
+	}
+	return false, err
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const ProviderKubeVirt = "kubevirt"
+
+// ErrNoRunnerImage is returned when no capi-runner image is configured for an operation
+var ErrNoRunnerImage = errors.New("no capi-runner image configured")
+
+// RunnerImages selects the image of the capi-runner Job, so the clusterctl, helm and kubectl versions in it match
+// the cluster. The most specific entry wins: a Kubernetes version of the provider, the provider default, then Default.
+// Versions are matched exactly first and then by minor version, e.g. "1.31".
+type RunnerImages struct {
+	Default   string                    `json:"default,omitempty"`
+	Providers map[string]ProviderImages `json:"providers,omitempty"`
+	// PullSecrets are copied from PullSecretNamespace into the namespace of every Job
+	PullSecrets         []string `json:"pullSecrets,omitempty"`
+	PullSecretNamespace string   `json:"pullSecretNamespace,omitempty"`
+}
+
+type ProviderImages struct {
+	Default  string            `json:"default,omitempty"`
+	Versions map[string]string `json:"versions,omitempty"`
+}
+
+// Resolve returns the image for the provider and Kubernetes version, the version may be empty
+func (r RunnerImages) Resolve(provider, kubernetesVersion string) (string, error) {
+	p := r.Providers[provider]
+	if kubernetesVersion != "" {
+		version := strings.TrimPrefix(kubernetesVersion, "v")
+		if img := p.Versions[version]; img != "" {
+			return img, nil
+		}
+		if parts := strings.SplitN(version, ".", 3); len(parts) >= 2 {
+			if img := p.Versions[parts[0]+"."+parts[1]]; img != "" {
+				return img, nil
+			}
+		}
+	}
+	if p.Default != "" {
+		return p.Default, nil
+	}
+	if r.Default != "" {
+		return r.Default, nil
+	}
+	if kubernetesVersion != "" {
+		return "", fmt.Errorf("%w for provider %s and Kubernetes version %s", ErrNoRunnerImage, provider, kubernetesVersion)
+	}
+	return "", fmt.Errorf("%w for provider %s", ErrNoRunnerImage, provider)
+}
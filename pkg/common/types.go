@@ -1,11 +1,11 @@
 package common
 
 import (
-	"bytes"
 	goctx "context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	tplfiles "github.com/RejwankabirHamim/cadence-iwf-poc/script"
-	"html/template"
-	"strconv"
 
 	"github.com/pkg/errors"
 	core "k8s.io/api/core/v1"
@@ -41,11 +41,33 @@ type ImportOptions struct {
 }
 
 type MachinePool struct {
-	MachineType  string `json:"machineType"`
-	MachineCount int    `json:"machineCount"`
-	CPU          int    `json:"cpu"`
-	Memory       int    `json:"memory"`
+	Name         string            `json:"name,omitempty"`
+	MachineType  string            `json:"machineType"`
+	MachineCount int               `json:"machineCount"`
+	CPU          int               `json:"cpu"`
+	Memory       int               `json:"memory"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Taints       []core.Taint      `json:"taints,omitempty"`
 }
+
+// workerPoolSpec is the per pool input of the configure_worker_pools function of the create scripts
+type workerPoolSpec struct {
+	Name         string            `json:"name"`
+	MachineCount int               `json:"machineCount"`
+	CPU          int               `json:"cpu"`
+	Memory       int               `json:"memory"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Taints       []core.Taint      `json:"taints,omitempty"`
+}
+
+// PoolName returns the name of the pool, pools without one are named after their position like clusterctl does
+func (p MachinePool) PoolName(index int) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return fmt.Sprintf("md-%d", index)
+}
+
 type CAPIClusterConfig struct {
 	ClusterName       string        `json:"clusterName,omitempty"`
 	Region            string        `json:"region,omitempty"`
@@ -66,55 +88,187 @@ type KubeVirtCreateOperation struct {
 	ImportOption       ImportOptions
 }
 
-func (opt KubeVirtCreateOperation) GetBaseImage(ctx goctx.Context, kc client.Client) (string, error) {
-	return "", nil
+func (opt KubeVirtCreateOperation) GetBaseImage(images RunnerImages) (string, error) {
+	return images.Resolve(ProviderKubeVirt, opt.CAPIConfig.KubernetesVersion)
 }
 
 func (opt KubeVirtCreateOperation) CreateScriptSecret(ctx goctx.Context, kc client.Client, scriptSecretName string) error {
-	var scriptTemplate *template.Template
-	var err error
-	if opt.CAPIConfig.ControlPlane == nil {
-		scriptTemplate, err = template.ParseFS(tplfiles.FS, "capi/kubevirt-kamaji-create.sh")
-	} else {
-		scriptTemplate, err = template.ParseFS(tplfiles.FS, "capi/kubevirt-create.sh")
-	}
+	script, err := opt.RenderScript(scriptSecretName)
 	if err != nil {
 		return err
 	}
-	scriptData := map[string]interface{}{
-		"cluster_name":           opt.CAPIConfig.ClusterName,
-		"cluster_namespace":      scriptSecretName,
-		"capk_guest_k8s_version": opt.CAPIConfig.KubernetesVersion,
+	err = createScriptSecret(ctx, kc, string(script), scriptSecretName, scriptSecretName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create or update script secret")
+	}
+	return nil
+}
+
+// RenderScript renders the creation script of a run in clusterNamespace
+func (opt KubeVirtCreateOperation) RenderScript(clusterNamespace string) ([]byte, error) {
+	params, err := opt.ScriptParams(clusterNamespace)
+	if err != nil {
+		return nil, err
+	}
+	script, err := tplfiles.Render(params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error in script template")
+	}
+	return script, nil
+}
+
+// ScriptParams returns the parameters of the creation script, a cluster without a control plane pool gets
+// its control plane from Kamaji
+func (opt KubeVirtCreateOperation) ScriptParams(clusterNamespace string) (tplfiles.Params, error) {
+	workerPools, err := opt.workerPoolsBase64()
+	if err != nil {
+		return nil, err
+	}
+	cfg := opt.CAPIConfig
+	firstPool := cfg.WorkerPools[0]
 
-		"worker_machine_count":  strconv.Itoa(opt.CAPIConfig.WorkerPools[0].MachineCount),
-		"worker_machine_cpu":    strconv.Itoa(opt.CAPIConfig.WorkerPools[0].CPU),
-		"worker_machine_memory": strconv.Itoa(opt.CAPIConfig.WorkerPools[0].Memory),
+	if cfg.ControlPlane == nil {
+		return tplfiles.KubeVirtKamajiCreateParams{
+			ClusterName:            cfg.ClusterName,
+			ClusterNamespace:       clusterNamespace,
+			KubernetesVersion:      cfg.KubernetesVersion,
+			AdminClusterKubeconfig: opt.KubeVirtCredential.KubeConfig,
+			WorkerMachineCount:     cfg.WorkerMachineCount(),
+			WorkerMachineCPU:       firstPool.CPU,
+			WorkerMachineMemory:    firstPool.Memory,
+			WorkerPoolsBase64:      workerPools,
+		}, nil
+	}
+	return tplfiles.KubeVirtCreateParams{
+		ClusterName:               cfg.ClusterName,
+		ClusterNamespace:          clusterNamespace,
+		KubernetesVersion:         cfg.KubernetesVersion,
+		AdminClusterKubeconfig:    opt.KubeVirtCredential.KubeConfig,
+		ControlPlaneMachineCount:  cfg.ControlPlane.MachineCount,
+		ControlPlaneMachineCPU:    cfg.ControlPlane.CPU,
+		ControlPlaneMachineMemory: cfg.ControlPlane.Memory,
+		WorkerMachineCount:        cfg.WorkerMachineCount(),
+		WorkerMachineCPU:          firstPool.CPU,
+		WorkerMachineMemory:       firstPool.Memory,
+		WorkerPoolsBase64:         workerPools,
+	}, nil
+}
+
+// workerPoolsBase64 encodes the worker pools for the script, base64 keeps the JSON intact through the shell
+func (opt KubeVirtCreateOperation) workerPoolsBase64() (string, error) {
+	if len(opt.CAPIConfig.WorkerPools) == 0 {
+		return "", errors.New("at least one worker pool is required")
+	}
+	seen := map[string]bool{}
+	pools := make([]workerPoolSpec, 0, len(opt.CAPIConfig.WorkerPools))
+	for i, pool := range opt.CAPIConfig.WorkerPools {
+		name := pool.PoolName(i)
+		if seen[name] {
+			return "", errors.Errorf("duplicate worker pool name %q", name)
+		}
+		seen[name] = true
 
-		"admin_cluster_kubeconfig_string": opt.KubeVirtCredential.KubeConfig,
+		labels := pool.Labels
+		if pool.MachineType != "" {
+			labels = make(map[string]string, len(pool.Labels)+1)
+			for k, v := range pool.Labels {
+				labels[k] = v
+			}
+			labels[core.LabelInstanceTypeStable] = pool.MachineType
+		}
+		pools = append(pools, workerPoolSpec{
+			Name:         name,
+			MachineCount: pool.MachineCount,
+			CPU:          pool.CPU,
+			Memory:       pool.Memory,
+			Labels:       labels,
+			Taints:       pool.Taints,
+		})
 	}
+	data, err := json.Marshal(pools)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
 
-	if opt.CAPIConfig.ControlPlane != nil {
-		scriptData["controlplane_machine_count"] = opt.CAPIConfig.ControlPlane.MachineCount
-		scriptData["controlplane_machine_cpu"] = opt.CAPIConfig.ControlPlane.CPU
-		scriptData["controlplane_machine_memory"] = opt.CAPIConfig.ControlPlane.Memory
+// WorkerMachineCount returns the number of worker machines across all pools
+func (cfg CAPIClusterConfig) WorkerMachineCount() int {
+	count := 0
+	for _, pool := range cfg.WorkerPools {
+		count += pool.MachineCount
 	}
+	return count
+}
+
+func (opt KubeVirtCreateOperation) GetCAPIConfig() *CAPIClusterConfig {
+	return opt.CAPIConfig
+}
+
+type ClusterDeleteConfig struct {
+	ClusterName    string `json:"clusterName,omitempty"`
+	InfraNamespace string `json:"infraNamespace,omitempty"`
+	// OwnerID owns the credential holding the cluster's kubeconfig, it is removed with the cluster
+	OwnerID int64 `json:"ownerID,omitempty"`
+}
+
+type KubeVirtDeleteOperation struct {
+	KubeVirtCredential *KubeVirtCredential
+	DeleteConfig       ClusterDeleteConfig
+}
 
-	var script bytes.Buffer
-	err = scriptTemplate.Execute(&script, scriptData)
+func (opt KubeVirtDeleteOperation) GetBaseImage(images RunnerImages) (string, error) {
+	return images.Resolve(ProviderKubeVirt, "")
+}
+
+func (opt KubeVirtDeleteOperation) CreateScriptSecret(ctx goctx.Context, kc client.Client, scriptSecretName string) error {
+	script, err := tplfiles.Render(tplfiles.KubeVirtDeleteParams{
+		ClusterName:            opt.DeleteConfig.ClusterName,
+		ClusterNamespace:       opt.DeleteConfig.InfraNamespace,
+		AdminClusterKubeconfig: opt.KubeVirtCredential.KubeConfig,
+	})
 	if err != nil {
 		return errors.Wrapf(err, "error in script template")
 	}
-	err = createScriptSecret(ctx, kc, script.String(), scriptSecretName, scriptSecretName)
+	err = createScriptSecret(ctx, kc, string(script), scriptSecretName, scriptSecretName)
 	if err != nil {
 		return errors.Wrapf(err, "failed to create or update script secret")
 	}
 	return nil
 }
 
-func (opt KubeVirtCreateOperation) GetCAPIConfig() *CAPIClusterConfig {
-	return opt.CAPIConfig
+type ClusterScaleConfig struct {
+	ClusterName    string `json:"clusterName,omitempty"`
+	InfraNamespace string `json:"infraNamespace,omitempty"`
+	PoolName       string `json:"poolName,omitempty"`
+	MachineCount   *int   `json:"machineCount,omitempty"`
+	CPU            int    `json:"cpu,omitempty"`
+	Memory         int    `json:"memory,omitempty"`
+}
+
+// MachineDeploymentName returns the name of the MachineDeployment backing the pool
+func (cfg ClusterScaleConfig) MachineDeploymentName() string {
+	return cfg.ClusterName + "-" + cfg.PoolName
+}
+
+type KubeVirtScaleOperation struct {
+	KubeVirtCredential *KubeVirtCredential
+	ScaleConfig        ClusterScaleConfig
+}
+
+type ClusterUpgradeConfig struct {
+	ClusterName       string `json:"clusterName,omitempty"`
+	InfraNamespace    string `json:"infraNamespace,omitempty"`
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
 }
 
+type KubeVirtUpgradeOperation struct {
+	KubeVirtCredential *KubeVirtCredential
+	UpgradeConfig      ClusterUpgradeConfig
+}
+
+// createScriptSecret creates the Secret holding script, or replaces the script of an existing one. A retried or
+// reset state renders into the Secret of the earlier attempt, so the patch must always carry the script.
 func createScriptSecret(ctx goctx.Context, kc client.Client, script, scriptName, scriptNamespace string) error {
 	secret := &core.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -122,13 +276,12 @@ func createScriptSecret(ctx goctx.Context, kc client.Client, script, scriptName,
 			Namespace: scriptNamespace,
 		},
 		Type: core.SecretTypeOpaque,
-		StringData: map[string]string{
-			"script.sh": script,
-		},
 	}
 	_, err := cu.CreateOrPatch(ctx, kc, secret, func(obj client.Object, createOp bool) client.Object {
 		sec := obj.(*core.Secret)
-		sec.Data = secret.Data
+		sec.Data = map[string][]byte{
+			"script.sh": []byte(script),
+		}
 		return sec
 	})
 	return err
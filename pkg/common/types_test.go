@@ -0,0 +1,50 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCreateScriptSecret(t *testing.T) {
+	existing := &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-abc123", Namespace: "demo-abc123"},
+		Type:       core.SecretTypeOpaque,
+		Data:       map[string][]byte{"script.sh": []byte("#!/bin/sh\necho old\n")},
+	}
+	tests := []struct {
+		name    string
+		objects []*core.Secret
+	}{
+		{name: "new secret"},
+		{name: "existing secret", objects: []*core.Secret{existing}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder()
+			for _, obj := range tt.objects {
+				builder = builder.WithObjects(obj.DeepCopy())
+			}
+			kc := builder.Build()
+
+			ctx := context.Background()
+			script := "#!/bin/sh\necho new\n"
+			if err := createScriptSecret(ctx, kc, script, "demo-abc123", "demo-abc123"); err != nil {
+				t.Fatalf("createScriptSecret() error = %v", err)
+			}
+
+			got := &core.Secret{}
+			if err := kc.Get(ctx, types.NamespacedName{Namespace: "demo-abc123", Name: "demo-abc123"}, got); err != nil {
+				t.Fatal(err)
+			}
+			if string(got.Data["script.sh"]) != script {
+				t.Errorf("script.sh = %q, want %q", got.Data["script.sh"], script)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Defaults of a MachinePool that leaves them empty, memory is in Gi like in the scripts
+const (
+	DefaultMachineCount  = 1
+	DefaultMachineCPU    = 2
+	DefaultMachineMemory = 4
+)
+
+// ProvisionLimits bound what a ClusterProvisionConfig may ask for
+type ProvisionLimits struct {
+	// DefaultKubernetesVersion is used when a request has none, it must be one of SupportedKubernetesVersions
+	DefaultKubernetesVersion string `json:"defaultKubernetesVersion,omitempty"`
+	// HubCIDRs are the pod, service and node ranges of the hub, a cluster network must not overlap them
+	HubCIDRs []string `json:"hubCIDRs,omitempty"`
+
+	MinCPU          int `json:"minCPU,omitempty"`
+	MaxCPU          int `json:"maxCPU,omitempty"`
+	MinMemory       int `json:"minMemory,omitempty"`
+	MaxMemory       int `json:"maxMemory,omitempty"`
+	MaxMachineCount int `json:"maxMachineCount,omitempty"`
+	MaxWorkerPools  int `json:"maxWorkerPools,omitempty"`
+}
+
+// DefaultProvisionLimits returns the limits used when the config file does not set them
+func DefaultProvisionLimits() ProvisionLimits {
+	return ProvisionLimits{
+		DefaultKubernetesVersion: SupportedKubernetesVersions[len(SupportedKubernetesVersions)-1],
+		MinCPU:                   1,
+		MaxCPU:                   64,
+		MinMemory:                2,
+		MaxMemory:                256,
+		MaxMachineCount:          100,
+		MaxWorkerPools:           10,
+	}
+}
+
+// Validate checks the limits read from the config file, a hub range that doesn't parse would disable the overlap
+// check of every request
+func (limits ProvisionLimits) Validate() error {
+	for _, cidr := range limits.HubCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid hub CIDR %q: %w", cidr, err)
+		}
+	}
+	return nil
+}
+
+// Default fills the fields a request may leave empty
+func (cfg *ClusterProvisionConfig) Default(limits ProvisionLimits) {
+	capi := &cfg.CAPIClusterConfig
+	if capi.KubernetesVersion == "" {
+		capi.KubernetesVersion = limits.DefaultKubernetesVersion
+	}
+	// the scripts add the "v" themselves
+	capi.KubernetesVersion = strings.TrimPrefix(capi.KubernetesVersion, "v")
+
+	if capi.ControlPlane != nil {
+		capi.ControlPlane.defaultResources()
+	}
+	for i := range capi.WorkerPools {
+		pool := &capi.WorkerPools[i]
+		pool.Name = pool.PoolName(i)
+		pool.defaultResources()
+	}
+
+	if cfg.ImportOptions.BasicInfo.Name == "" {
+		cfg.ImportOptions.BasicInfo.Name = capi.ClusterName
+	}
+	if cfg.ImportOptions.BasicInfo.DisplayName == "" {
+		cfg.ImportOptions.BasicInfo.DisplayName = cfg.ImportOptions.BasicInfo.Name
+	}
+}
+
+func (p *MachinePool) defaultResources() {
+	if p.MachineCount == 0 {
+		p.MachineCount = DefaultMachineCount
+	}
+	if p.CPU == 0 {
+		p.CPU = DefaultMachineCPU
+	}
+	if p.Memory == 0 {
+		p.Memory = DefaultMachineMemory
+	}
+}
+
+// Validate returns every problem of a defaulted ClusterProvisionConfig
+func (cfg ClusterProvisionConfig) Validate(limits ProvisionLimits) field.ErrorList {
+	allErrs := cfg.CAPIClusterConfig.validate(limits, field.NewPath("capiClusterConfig"))
+	return append(allErrs, cfg.ImportOptions.validate(field.NewPath("importOptions"))...)
+}
+
+func (cfg CAPIClusterConfig) validate(limits ProvisionLimits, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if cfg.ClusterName == "" {
+		allErrs = append(allErrs, field.Required(path.Child("clusterName"), ""))
+	} else {
+		for _, msg := range validation.IsDNS1123Label(cfg.ClusterName) {
+			allErrs = append(allErrs, field.Invalid(path.Child("clusterName"), cfg.ClusterName, msg))
+		}
+		// the runner namespaces are named after the cluster
+		if len(cfg.ClusterName) > MaxClusterNameLength {
+			allErrs = append(allErrs, field.TooLong(path.Child("clusterName"), cfg.ClusterName, MaxClusterNameLength))
+		}
+	}
+
+	if cfg.KubernetesVersion == "" {
+		allErrs = append(allErrs, field.Required(path.Child("kubernetesVersion"), ""))
+	} else if !IsSupportedKubernetesVersion(cfg.KubernetesVersion) {
+		allErrs = append(allErrs, field.NotSupported(path.Child("kubernetesVersion"), cfg.KubernetesVersion, SupportedKubernetesVersions))
+	}
+	if cfg.NetworkCIDR != "" {
+		allErrs = append(allErrs, validateNetworkCIDR(cfg.NetworkCIDR, limits.HubCIDRs, path.Child("networkCIDR"))...)
+	}
+
+	if cfg.ControlPlane != nil {
+		cpPath := path.Child("controlPlane")
+		allErrs = append(allErrs, cfg.ControlPlane.validate(limits, cpPath)...)
+		// etcd needs an odd number of members to keep its quorum
+		if cfg.ControlPlane.MachineCount%2 == 0 {
+			allErrs = append(allErrs, field.Invalid(cpPath.Child("machineCount"), cfg.ControlPlane.MachineCount, "must be odd"))
+		}
+	}
+
+	poolsPath := path.Child("workerPools")
+	switch {
+	case len(cfg.WorkerPools) == 0:
+		allErrs = append(allErrs, field.Required(poolsPath, "at least one worker pool is required"))
+	case limits.MaxWorkerPools > 0 && len(cfg.WorkerPools) > limits.MaxWorkerPools:
+		allErrs = append(allErrs, field.TooMany(poolsPath, len(cfg.WorkerPools), limits.MaxWorkerPools))
+	}
+	names := sets.New[string]()
+	for i, pool := range cfg.WorkerPools {
+		poolPath := poolsPath.Index(i)
+		allErrs = append(allErrs, pool.validate(limits, poolPath)...)
+		for _, msg := range validation.IsDNS1123Label(pool.Name) {
+			allErrs = append(allErrs, field.Invalid(poolPath.Child("name"), pool.Name, msg))
+		}
+		if names.Has(pool.Name) {
+			allErrs = append(allErrs, field.Duplicate(poolPath.Child("name"), pool.Name))
+		}
+		names.Insert(pool.Name)
+	}
+	return allErrs
+}
+
+func (p MachinePool) validate(limits ProvisionLimits, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, validateRange(p.MachineCount, 1, limits.MaxMachineCount, path.Child("machineCount"))...)
+	allErrs = append(allErrs, validateRange(p.CPU, limits.MinCPU, limits.MaxCPU, path.Child("cpu"))...)
+	allErrs = append(allErrs, validateRange(p.Memory, limits.MinMemory, limits.MaxMemory, path.Child("memory"))...)
+	allErrs = append(allErrs, metav1validation.ValidateLabels(p.Labels, path.Child("labels"))...)
+
+	effects := []core.TaintEffect{core.TaintEffectNoSchedule, core.TaintEffectPreferNoSchedule, core.TaintEffectNoExecute}
+	for i, taint := range p.Taints {
+		taintPath := path.Child("taints").Index(i)
+		for _, msg := range validation.IsQualifiedName(taint.Key) {
+			allErrs = append(allErrs, field.Invalid(taintPath.Child("key"), taint.Key, msg))
+		}
+		if taint.Value != "" {
+			for _, msg := range validation.IsValidLabelValue(taint.Value) {
+				allErrs = append(allErrs, field.Invalid(taintPath.Child("value"), taint.Value, msg))
+			}
+		}
+		if !sets.New(effects...).Has(taint.Effect) {
+			allErrs = append(allErrs, field.NotSupported(taintPath.Child("effect"), taint.Effect, effects))
+		}
+	}
+	return allErrs
+}
+
+func (opts ImportOptions) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if name := opts.BasicInfo.Name; name != "" {
+		for _, msg := range validation.IsDNS1123Label(name) {
+			allErrs = append(allErrs, field.Invalid(path.Child("basicInfo", "name"), name, msg))
+		}
+	}
+	if opts.Provider.Credential == "" {
+		allErrs = append(allErrs, field.Required(path.Child("provider", "credential"), ""))
+	}
+	if opts.Provider.KubeConfig != "" {
+		allErrs = append(allErrs, field.Forbidden(path.Child("provider", "kubeConfig"), "is set once the cluster is created"))
+	}
+	return allErrs
+}
+
+func validateNetworkCIDR(cidr string, hubCIDRs []string, path *field.Path) field.ErrorList {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, cidr, "must be a CIDR like 10.244.0.0/16")}
+	}
+	var allErrs field.ErrorList
+	for _, hub := range hubCIDRs {
+		_, hubNet, err := net.ParseCIDR(hub)
+		if err != nil {
+			// Validate of the limits rejects this when the config is loaded
+			allErrs = append(allErrs, field.InternalError(path, fmt.Errorf("invalid hub range %q: %w", hub, err)))
+			continue
+		}
+		if network.Contains(hubNet.IP) || hubNet.Contains(network.IP) {
+			allErrs = append(allErrs, field.Invalid(path, cidr, fmt.Sprintf("overlaps with the hub range %s", hub)))
+		}
+	}
+	return allErrs
+}
+
+// validateRange checks min <= v <= max, a bound of 0 is not checked
+func validateRange(v, min, max int, path *field.Path) field.ErrorList {
+	if min > 0 && v < min {
+		return field.ErrorList{field.Invalid(path, v, fmt.Sprintf("must be at least %d", min))}
+	}
+	if max > 0 && v > max {
+		return field.ErrorList{field.Invalid(path, v, fmt.Sprintf("must be at most %d", max))}
+	}
+	return nil
+}
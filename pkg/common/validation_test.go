@@ -0,0 +1,155 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// validProvisionConfig returns a defaulted request that passes validation
+func validProvisionConfig() ClusterProvisionConfig {
+	cfg := ClusterProvisionConfig{
+		CAPIClusterConfig: CAPIClusterConfig{
+			ClusterName: "demo",
+			WorkerPools: []MachinePool{{}},
+		},
+		ImportOptions: ImportOptions{Provider: ProviderOptions{Credential: "infra"}},
+	}
+	cfg.Default(DefaultProvisionLimits())
+	return cfg
+}
+
+func TestValidateClusterName(t *testing.T) {
+	tests := []struct {
+		name        string
+		clusterName string
+		wantType    field.ErrorType
+	}{
+		{name: "valid", clusterName: "demo"},
+		{name: "longest", clusterName: strings.Repeat("a", MaxClusterNameLength)},
+		{name: "too long for the delete namespace", clusterName: strings.Repeat("a", MaxClusterNameLength+1), wantType: field.ErrorTypeTooLong},
+		{name: "empty", clusterName: "", wantType: field.ErrorTypeRequired},
+		{name: "upper case", clusterName: "Demo", wantType: field.ErrorTypeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validProvisionConfig()
+			cfg.CAPIClusterConfig.ClusterName = tt.clusterName
+			errs := cfg.Validate(DefaultProvisionLimits())
+			if tt.wantType == "" {
+				if len(errs) > 0 {
+					t.Fatalf("Validate() = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Type != tt.wantType || errs[0].Field != "capiClusterConfig.clusterName" {
+				t.Fatalf("Validate() = %v, want one %s error of capiClusterConfig.clusterName", errs, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestNamespaceNamesFitClusterName(t *testing.T) {
+	clusterName := strings.Repeat("a", MaxClusterNameLength)
+	for _, name := range []string{RunnerNamespaceName(clusterName), DeleteNamespaceName(clusterName)} {
+		if len(name) > 63 {
+			t.Errorf("namespace %s is %d characters long, more than a namespace name may have", name, len(name))
+		}
+	}
+}
+
+func TestProvisionLimitsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		hubCIDRs []string
+		wantErr  bool
+	}{
+		{name: "no hub ranges"},
+		{name: "valid hub ranges", hubCIDRs: []string{"10.96.0.0/12", "fd00::/108"}},
+		{name: "address without prefix", hubCIDRs: []string{"10.96.0.0"}, wantErr: true},
+		{name: "garbage", hubCIDRs: []string{"10.96.0.0/12", "pods"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := DefaultProvisionLimits()
+			limits.HubCIDRs = tt.hubCIDRs
+			if err := limits.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNetworkCIDR(t *testing.T) {
+	tests := []struct {
+		name        string
+		networkCIDR string
+		hubCIDRs    []string
+		wantType    field.ErrorType
+	}{
+		{name: "no network"},
+		{name: "no hub ranges", networkCIDR: "10.244.0.0/16"},
+		{name: "apart from the hub", networkCIDR: "10.244.0.0/16", hubCIDRs: []string{"10.96.0.0/12", "192.168.0.0/24"}},
+		{name: "inside a hub range", networkCIDR: "10.100.0.0/16", hubCIDRs: []string{"10.96.0.0/12"}, wantType: field.ErrorTypeInvalid},
+		{name: "containing a hub range", networkCIDR: "10.0.0.0/8", hubCIDRs: []string{"10.96.0.0/12"}, wantType: field.ErrorTypeInvalid},
+		{name: "not a CIDR", networkCIDR: "10.244.0.0", wantType: field.ErrorTypeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := DefaultProvisionLimits()
+			limits.HubCIDRs = tt.hubCIDRs
+			cfg := validProvisionConfig()
+			cfg.CAPIClusterConfig.NetworkCIDR = tt.networkCIDR
+			errs := cfg.Validate(limits)
+			if tt.wantType == "" {
+				if len(errs) > 0 {
+					t.Fatalf("Validate() = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Type != tt.wantType || errs[0].Field != "capiClusterConfig.networkCIDR" {
+				t.Fatalf("Validate() = %v, want one %s error of capiClusterConfig.networkCIDR", errs, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestValidateWorkerPoolNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		poolNames []string
+		wantField string
+		wantType  field.ErrorType
+	}{
+		{name: "defaulted names", poolNames: []string{"", ""}},
+		{name: "distinct names", poolNames: []string{"general", "gpu"}},
+		{name: "duplicate", poolNames: []string{"general", "general"}, wantField: "capiClusterConfig.workerPools[1].name", wantType: field.ErrorTypeDuplicate},
+		{name: "duplicate of a defaulted name", poolNames: []string{"", "md-0"}, wantField: "capiClusterConfig.workerPools[1].name", wantType: field.ErrorTypeDuplicate},
+		{name: "not a label", poolNames: []string{"GPU_pool"}, wantField: "capiClusterConfig.workerPools[0].name", wantType: field.ErrorTypeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validProvisionConfig()
+			cfg.CAPIClusterConfig.WorkerPools = nil
+			for _, name := range tt.poolNames {
+				cfg.CAPIClusterConfig.WorkerPools = append(cfg.CAPIClusterConfig.WorkerPools, MachinePool{Name: name})
+			}
+			cfg.Default(DefaultProvisionLimits())
+			errs := cfg.Validate(DefaultProvisionLimits())
+			if tt.wantType == "" {
+				if len(errs) > 0 {
+					t.Fatalf("Validate() = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || errs[0].Type != tt.wantType || errs[0].Field != tt.wantField {
+				t.Fatalf("Validate() = %v, want a %s error of %s", errs, tt.wantType, tt.wantField)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+const nodeVMImageRepository = "quay.io/capk/ubuntu-2204-container-disk"
+
+// SupportedKubernetesVersions lists the guest cluster versions a container disk image is published for
+var SupportedKubernetesVersions = []string{
+	"1.29.14",
+	"1.30.10",
+	"1.31.6",
+	"1.32.3",
+}
+
+// NodeVMImage returns the container disk image the machines of the given Kubernetes version boot from
+func NodeVMImage(kubernetesVersion string) string {
+	return fmt.Sprintf("%s:v%s", nodeVMImageRepository, strings.TrimPrefix(kubernetesVersion, "v"))
+}
+
+// IsSupportedKubernetesVersion reports whether the version is part of SupportedKubernetesVersions
+func IsSupportedKubernetesVersion(kubernetesVersion string) bool {
+	v := strings.TrimPrefix(kubernetesVersion, "v")
+	for _, supported := range SupportedKubernetesVersions {
+		if v == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateKubernetesUpgrade checks that a cluster can move from one version to the other,
+// the target must be supported, newer than the current version and at most one minor version ahead.
+func ValidateKubernetesUpgrade(from, to string) error {
+	if !IsSupportedKubernetesVersion(to) {
+		return fmt.Errorf("kubernetes version %s is not supported, supported versions are %s", to, strings.Join(SupportedKubernetesVersions, ", "))
+	}
+	current, err := version.ParseSemantic(strings.TrimPrefix(from, "v"))
+	if err != nil {
+		return fmt.Errorf("invalid current kubernetes version %q: %v", from, err)
+	}
+	target := version.MustParseSemantic(strings.TrimPrefix(to, "v"))
+	if !current.LessThan(target) {
+		return fmt.Errorf("kubernetes version %s is not newer than the current version %s", to, from)
+	}
+	if target.Major() != current.Major() || target.Minor() > current.Minor()+1 {
+		return fmt.Errorf("kubernetes version %s skips a minor version, upgrade from %s one minor version at a time", to, from)
+	}
+	return nil
+}
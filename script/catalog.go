@@ -0,0 +1,157 @@
+package script
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Logical names of the templates the workflows render
+const (
+	KubeVirtCreate       = "kubevirt/create"
+	KubeVirtKamajiCreate = "kubevirt/kamaji-create"
+	KubeVirtDelete       = "kubevirt/delete"
+)
+
+// Control plane modes of a creation template
+const (
+	ControlPlaneMachines = "machines"
+	ControlPlaneKamaji   = "kamaji"
+)
+
+// Sources a template is loaded from
+const (
+	SourceEmbedded = "embedded"
+	SourceOverlay  = "overlay"
+)
+
+// ErrTemplateNotFound is returned for a logical name that is not in the catalog
+var ErrTemplateNotFound = errors.New("script template not found")
+
+// TemplateInfo describes one template of the catalog
+type TemplateInfo struct {
+	Name         string `json:"name"`
+	File         string `json:"file"`
+	Provider     string `json:"provider"`
+	Operation    string `json:"operation"`
+	ControlPlane string `json:"controlPlane,omitempty"`
+	// RequiredParams name the fields of the template's Params that its Validate checks, in this order
+	RequiredParams []string `json:"requiredParams"`
+	Source         string   `json:"source"`
+}
+
+var templates = []TemplateInfo{
+	{
+		Name:         KubeVirtCreate,
+		File:         "kubevirt-create.sh",
+		Provider:     "kubevirt",
+		Operation:    "create",
+		ControlPlane: ControlPlaneMachines,
+		RequiredParams: []string{
+			"ClusterName", "ClusterNamespace", "KubernetesVersion", "AdminClusterKubeconfig",
+			"ControlPlaneMachineCount", "ControlPlaneMachineCPU", "ControlPlaneMachineMemory",
+			"WorkerMachineCPU", "WorkerMachineMemory", "WorkerPoolsBase64",
+		},
+	},
+	{
+		Name:         KubeVirtKamajiCreate,
+		File:         "kubevirt-kamaji-create.sh",
+		Provider:     "kubevirt",
+		Operation:    "create",
+		ControlPlane: ControlPlaneKamaji,
+		RequiredParams: []string{
+			"ClusterName", "ClusterNamespace", "KubernetesVersion", "AdminClusterKubeconfig",
+			"WorkerMachineCPU", "WorkerMachineMemory", "WorkerPoolsBase64",
+		},
+	},
+	{
+		Name:           KubeVirtDelete,
+		File:           "kubevirt-delete.sh",
+		Provider:       "kubevirt",
+		Operation:      "delete",
+		RequiredParams: []string{"ClusterName", "ClusterNamespace", "AdminClusterKubeconfig"},
+	},
+}
+
+// Catalog loads the script templates by logical name. A file with the same name in the overlay directory
+// replaces the embedded template; it is read on every load, so operators can change it without a rebuild or restart.
+type Catalog struct {
+	overlayDir string
+}
+
+// NewCatalog returns a Catalog of the embedded templates, overlayDir may be empty
+func NewCatalog(overlayDir string) *Catalog {
+	return &Catalog{overlayDir: overlayDir}
+}
+
+// List returns the templates of the catalog sorted by name
+func (c *Catalog) List() []TemplateInfo {
+	list := make([]TemplateInfo, 0, len(templates))
+	for _, info := range templates {
+		info.Source = c.source(info.File)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Get returns the metadata of the template with the logical name
+func (c *Catalog) Get(name string) (TemplateInfo, error) {
+	for _, info := range templates {
+		if info.Name == name {
+			info.Source = c.source(info.File)
+			return info, nil
+		}
+	}
+	return TemplateInfo{}, errors.Wrap(ErrTemplateNotFound, name)
+}
+
+// Load parses the template with the logical name
+func (c *Catalog) Load(name string) (*template.Template, error) {
+	info, err := c.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	var files fs.FS = FS
+	if info.Source == SourceOverlay {
+		files = os.DirFS(c.overlayDir)
+	}
+	tpl, err := template.New(info.File).Option("missingkey=error").Funcs(funcs).ParseFS(files, info.File)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s script template %s", info.Source, name)
+	}
+	return tpl, nil
+}
+
+func (c *Catalog) source(file string) string {
+	if c.overlayDir != "" {
+		if st, err := os.Stat(filepath.Join(c.overlayDir, file)); err == nil && st.Mode().IsRegular() {
+			return SourceOverlay
+		}
+	}
+	return SourceEmbedded
+}
+
+var (
+	catalog   = NewCatalog("")
+	catalogMu sync.RWMutex
+)
+
+// SetCatalog replaces the Catalog used by Render
+func SetCatalog(c *Catalog) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	catalog = c
+}
+
+// DefaultCatalog returns the Catalog used by Render
+func DefaultCatalog() *Catalog {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	return catalog
+}
@@ -5,14 +5,15 @@ cd ${HOME}
 
 set -eou pipefail
 
-export CAPK_GUEST_K8S_VERSION="{{ .capk_guest_k8s_version }}"
-export CLUSTER_NAME="{{ .cluster_name }}"
-export CONTROL_PLANE_MACHINE_COUNT="{{ .controlplane_machine_count }}"
-export CONTROL_PLANE_MACHINE_CPU="{{ .controlplane_machine_cpu }}"
-export CONTROL_PLANE_MACHINE_MEMORY="{{ .controlplane_machine_memory }}"
-export WORKER_MACHINE_COUNT="{{ .worker_machine_count }}"
-export WORKER_MACHINE_CPU="{{ .worker_machine_cpu }}"
-export WORKER_MACHINE_MEMORY="{{ .worker_machine_memory }}"
+export CAPK_GUEST_K8S_VERSION={{ .KubernetesVersion | shellQuote }}
+export CLUSTER_NAME={{ .ClusterName | shellQuote }}
+export CONTROL_PLANE_MACHINE_COUNT={{ .ControlPlaneMachineCount }}
+export CONTROL_PLANE_MACHINE_CPU={{ .ControlPlaneMachineCPU }}
+export CONTROL_PLANE_MACHINE_MEMORY={{ .ControlPlaneMachineMemory }}
+export WORKER_MACHINE_COUNT={{ .WorkerMachineCount }}
+export WORKER_MACHINE_CPU={{ .WorkerMachineCPU }}
+export WORKER_MACHINE_MEMORY={{ .WorkerMachineMemory }}
+WORKER_POOLS_JSON=$(echo {{ .WorkerPoolsBase64 | shellQuote }} | base64 -d)
 export KUBERNETES_VERSION="v${CAPK_GUEST_K8S_VERSION}"
 export NODE_VM_IMAGE_TEMPLATE="quay.io/capk/ubuntu-2204-container-disk:v${CAPK_GUEST_K8S_VERSION}"
 
@@ -29,9 +30,9 @@ INFRA_CSI_VERSION=v0.1.0
 TENANT_CSI_VERSION=v0.1.0
 INFRA_STORAGE_CLASS_NAME=hvl
 INFRA_SNAPSHOT_CLASS_NAME=longhorn-snapshot
-ADMIN_CLUSTER_KUBECONFIG_STRING='{{.admin_cluster_kubeconfig_string}}'
+ADMIN_CLUSTER_KUBECONFIG_STRING={{ .AdminClusterKubeconfig | shellQuote }}
 PROVIDER_NAME=kubevirt
-CLUSTER_NAMESPACE="{{.cluster_namespace}}"
+CLUSTER_NAMESPACE={{ .ClusterNamespace | shellQuote }}
 CONFIGMAP_NAME="coredns"
 CONFIGMAP_NAMESPACE="kube-system"
 WORKLOAD_KUBECONFIG=""
@@ -48,9 +49,14 @@ rollback() {
     log "INFO" "Rollback completed."
 }
 
+CURRENT_STEP=""
+
 function finish {
     result=$?
     if [ $result -ne 0 ]; then
+        if [ -n "$CURRENT_STEP" ]; then
+            log "PROGRESS" "step=$CURRENT_STEP status=failed"
+        fi
         rollback || true
         log "ERROR" "Cluster Creation: $NATS_FAILURE_MESSAGE !!!"
     else
@@ -94,6 +100,15 @@ retry() {
     return 0
 }
 
+# step runs one phase of the script between PROGRESS marker lines, the workflow reads them to report progress
+step() {
+    CURRENT_STEP="$1"
+    log "PROGRESS" "step=$CURRENT_STEP status=started"
+    "$1"
+    log "PROGRESS" "step=$CURRENT_STEP status=succeeded"
+    CURRENT_STEP=""
+}
+
 write_ADMIN_CLUSTER_kubeconfig_string() {
     log "INFO" "Writing Admin cluster kubeconfig string."
     echo "$ADMIN_CLUSTER_KUBECONFIG_STRING" >admin-cluster-kubeconfig.yaml
@@ -101,13 +116,52 @@ write_ADMIN_CLUSTER_kubeconfig_string() {
     export ADMIN_CLUSTER_KUBECONFIG=${KUBECONFIG}
 }
 
+configure_worker_pools() {
+    # Replaces the single generated MachineDeployment (and its machine and bootstrap templates)
+    # with one copy per requested worker pool.
+    local in="$1"
+    local out="$2"
+    log "INFO" "Configuring worker pools."
+    kubectl create --dry-run=client -o json -f ${in} >cluster.json
+    jq --argjson pools "$WORKER_POOLS_JSON" --arg cluster "$CLUSTER_NAME" '
+        (.items | map(select(.kind == "MachineDeployment")) | first) as $md
+        | ($md.spec.template.spec.infrastructureRef) as $infraRef
+        | ($md.spec.template.spec.bootstrap.configRef) as $bootRef
+        | (.items | map(select(.kind == $infraRef.kind and .metadata.name == $infraRef.name)) | first) as $infra
+        | (.items | map(select(.kind == $bootRef.kind and .metadata.name == $bootRef.name)) | first) as $boot
+        | .items |= map(select(. != $md and . != $infra and . != $boot))
+        | .items += [$pools[] as $p | ($cluster + "-" + $p.name) as $name
+            | ($infra
+                | .metadata.name = $name
+                | .spec.template.spec.virtualMachineTemplate.spec.template.spec.domain.cpu.cores = $p.cpu
+                | .spec.template.spec.virtualMachineTemplate.spec.template.spec.domain.memory.guest = "\($p.memory)Gi"),
+              ($boot
+                | .metadata.name = $name
+                | if ($p.labels // {}) == {} then . else
+                    .spec.template.spec.joinConfiguration.nodeRegistration.kubeletExtraArgs["node-labels"] =
+                        ($p.labels | to_entries | map("\(.key)=\(.value)") | join(","))
+                  end
+                | if ($p.taints // []) == [] then . else
+                    .spec.template.spec.joinConfiguration.nodeRegistration.taints = $p.taints
+                  end),
+              ($md
+                | .metadata.name = $name
+                | .spec.replicas = $p.machineCount
+                | .spec.selector.matchLabels = {}
+                | del(.spec.template.metadata.labels["cluster.x-k8s.io/deployment-name"])
+                | .spec.template.spec.infrastructureRef.name = $name
+                | .spec.template.spec.bootstrap.configRef.name = $name)]
+    ' cluster.json >${out}
+}
+
 create_kubevirt_cluster() {
     log "INFO" "Creating Workload cluster."
     local cmnd="clusterctl generate cluster"
     retry 5 ${cmnd} ${CLUSTER_NAME} --infrastructure "${PROVIDER_NAME}" --kubernetes-version ${KUBERNETES_VERSION} --control-plane-machine-count=${CONTROL_PLANE_MACHINE_COUNT} --worker-machine-count=${WORKER_MACHINE_COUNT} -n ${CLUSTER_NAMESPACE} --config=/home/assets/config.yaml >cluster.yaml
     capi-config-linux-amd64 capk <./cluster.yaml >./configured-cluster.yaml
+    configure_worker_pools configured-cluster.yaml configured-cluster.json
     kubectl create ns $CLUSTER_NAMESPACE --kubeconfig=${ADMIN_CLUSTER_KUBECONFIG} || true
-    cmnd="kubectl apply -f configured-cluster.yaml -n ${CLUSTER_NAMESPACE}"
+    cmnd="kubectl apply -f configured-cluster.json -n ${CLUSTER_NAMESPACE}"
     retry 5 ${cmnd}
 
     log "INFO" "Waiting for cluster to be ready."
@@ -172,12 +226,13 @@ EOF
 
 init() {
     log "INFO" "Starting Cluster Creation Script."
-    write_ADMIN_CLUSTER_kubeconfig_string
-    create_kubevirt_cluster
-    generate_kubeconfig
-    install_cni
-    add_cluster_local_as_dns_domain
-    install_csi
+    log "PROGRESS" "steps=write_ADMIN_CLUSTER_kubeconfig_string,create_kubevirt_cluster,generate_kubeconfig,install_cni,add_cluster_local_as_dns_domain,install_csi"
+    step write_ADMIN_CLUSTER_kubeconfig_string
+    step create_kubevirt_cluster
+    step generate_kubeconfig
+    step install_cni
+    step add_cluster_local_as_dns_domain
+    step install_csi
 }
 
 init
@@ -0,0 +1,114 @@
+#!/bin/bash
+
+HOME="/data"
+cd ${HOME}
+
+set -eou pipefail
+
+export CLUSTER_NAME={{ .ClusterName | shellQuote }}
+
+export NATS_SUCCESS_MESSAGE="Task Completed Successfully"
+export NATS_FAILURE_MESSAGE="Task Failed"
+
+ADMIN_CLUSTER_KUBECONFIG_STRING={{ .AdminClusterKubeconfig | shellQuote }}
+CLUSTER_NAMESPACE={{ .ClusterNamespace | shellQuote }}
+WORKLOAD_KUBECONFIG=""
+
+function finish {
+    result=$?
+    if [ $result -ne 0 ]; then
+        log "ERROR" "Cluster Deletion: $NATS_FAILURE_MESSAGE !!!"
+    else
+        # Cluster Deleted Successfully
+        log "INFO" "Cluster Deletion: $NATS_SUCCESS_MESSAGE !!!"
+    fi
+    sleep 10
+
+    exit $result
+}
+
+trap finish EXIT
+
+timestamp() {
+    date +"%Y/%m/%d %T"
+}
+
+log() {
+    local type="$1"
+    local msg="$2"
+    local script_name=${0##*/}
+    echo "$(timestamp) [$script_name] [$type] $msg"
+}
+
+retry() {
+    local retries="$1"
+    shift
+    local count=0
+    local wait=5
+    until "$@"; do
+        exit="$?"
+        if [ $count -lt $retries ]; then
+            log "INFO" "Attempt $count/$retries. Command exited with exit_code: $exit. Retrying after $wait seconds..."
+            sleep $wait
+        else
+            log "ERROR" "Command failed in all $retries attempts with exit_code: $exit. Stopping further attempts."
+            return $exit
+        fi
+        count=$(($count + 1))
+    done
+    return 0
+}
+
+write_ADMIN_CLUSTER_kubeconfig_string() {
+    log "INFO" "Writing Admin cluster kubeconfig string."
+    echo "$ADMIN_CLUSTER_KUBECONFIG_STRING" >admin-cluster-kubeconfig.yaml
+    export KUBECONFIG=admin-cluster-kubeconfig.yaml
+    export ADMIN_CLUSTER_KUBECONFIG=${KUBECONFIG}
+}
+
+generate_kubeconfig() {
+    log "INFO" "Generating kubeconfig."
+    if clusterctl get kubeconfig ${CLUSTER_NAME} -n ${CLUSTER_NAMESPACE} --kubeconfig=${ADMIN_CLUSTER_KUBECONFIG} >$HOME/cluster.kubeconfig; then
+        WORKLOAD_KUBECONFIG=$HOME/cluster.kubeconfig
+    else
+        log "INFO" "Kubeconfig of cluster ${CLUSTER_NAME} is not available, skipping workload cluster cleanup."
+    fi
+}
+
+uninstall_csi() {
+    log "INFO" "Uninstalling csi...."
+    if [ -n "$WORKLOAD_KUBECONFIG" ]; then
+        helm uninstall kubevirt-tenant-csi-driver -n kubevirt-csi-driver --kubeconfig=${WORKLOAD_KUBECONFIG} || true
+    fi
+    if helm status kubevirt-infra-csi-driver -n ${CLUSTER_NAMESPACE} --kubeconfig=${ADMIN_CLUSTER_KUBECONFIG} >/dev/null 2>&1; then
+        retry 5 helm uninstall kubevirt-infra-csi-driver -n ${CLUSTER_NAMESPACE} --kubeconfig=${ADMIN_CLUSTER_KUBECONFIG}
+    fi
+    log "INFO" "Successfully uninstalled CSI"
+}
+
+delete_kubevirt_cluster() {
+    log "INFO" "Deleting Workload cluster."
+    local cmnd="kubectl delete cluster ${CLUSTER_NAME} -n ${CLUSTER_NAMESPACE} --ignore-not-found --wait=false"
+    retry 5 ${cmnd} --kubeconfig=${ADMIN_CLUSTER_KUBECONFIG}
+
+    log "INFO" "Waiting for cluster to be deleted."
+    kubectl wait --for=delete cluster/${CLUSTER_NAME} -n ${CLUSTER_NAMESPACE} --timeout=30m --kubeconfig=${ADMIN_CLUSTER_KUBECONFIG} || true
+    log "INFO" "Cluster ${CLUSTER_NAME} deleted successfully."
+}
+
+delete_cluster_namespace() {
+    log "INFO" "Deleting cluster namespace ${CLUSTER_NAMESPACE}."
+    local cmnd="kubectl delete ns ${CLUSTER_NAMESPACE} --ignore-not-found --timeout=10m"
+    retry 5 ${cmnd} --kubeconfig=${ADMIN_CLUSTER_KUBECONFIG}
+}
+
+init() {
+    log "INFO" "Starting Cluster Deletion Script."
+    write_ADMIN_CLUSTER_kubeconfig_string
+    generate_kubeconfig
+    uninstall_csi
+    delete_kubevirt_cluster
+    delete_cluster_namespace
+}
+
+init
@@ -2,9 +2,5 @@ package script
 
 import "embed"
 
-//go:embed *.tmpl
-//go:embed **/*.tmpl
-//go:embed **/*.sh
-//go:embed **/**/*.tmpl
-//go:embed **/**/**/*.tmpl
+//go:embed *.sh
 var FS embed.FS
@@ -0,0 +1,121 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Params are the typed parameters of one script template
+type Params interface {
+	// TemplateName is the logical name of the catalog template the parameters are rendered into
+	TemplateName() string
+	// Validate reports the first required parameter of the catalog's RequiredParams that is missing
+	Validate() error
+}
+
+// KubeVirtCreateParams render kubevirt-create.sh, a cluster with a dedicated control plane
+type KubeVirtCreateParams struct {
+	ClusterName            string
+	ClusterNamespace       string
+	KubernetesVersion      string
+	AdminClusterKubeconfig string
+
+	ControlPlaneMachineCount  int
+	ControlPlaneMachineCPU    int
+	ControlPlaneMachineMemory int
+
+	WorkerMachineCount  int
+	WorkerMachineCPU    int
+	WorkerMachineMemory int
+	WorkerPoolsBase64   string
+}
+
+func (p KubeVirtCreateParams) TemplateName() string { return KubeVirtCreate }
+
+func (p KubeVirtCreateParams) Validate() error { return requireParams(p) }
+
+// KubeVirtKamajiCreateParams render kubevirt-kamaji-create.sh, a cluster whose control plane is hosted by Kamaji
+type KubeVirtKamajiCreateParams struct {
+	ClusterName            string
+	ClusterNamespace       string
+	KubernetesVersion      string
+	AdminClusterKubeconfig string
+
+	WorkerMachineCount  int
+	WorkerMachineCPU    int
+	WorkerMachineMemory int
+	WorkerPoolsBase64   string
+}
+
+func (p KubeVirtKamajiCreateParams) TemplateName() string { return KubeVirtKamajiCreate }
+
+func (p KubeVirtKamajiCreateParams) Validate() error { return requireParams(p) }
+
+// KubeVirtDeleteParams render kubevirt-delete.sh
+type KubeVirtDeleteParams struct {
+	ClusterName            string
+	ClusterNamespace       string
+	AdminClusterKubeconfig string
+}
+
+func (p KubeVirtDeleteParams) TemplateName() string { return KubeVirtDelete }
+
+func (p KubeVirtDeleteParams) Validate() error { return requireParams(p) }
+
+// requireParams checks the RequiredParams the catalog lists for the template of p, in the order they are listed:
+// a string parameter must be set and a number must be positive
+func requireParams(p Params) error {
+	info, err := DefaultCatalog().Get(p.TemplateName())
+	if err != nil {
+		return err
+	}
+	values := reflect.ValueOf(p)
+	for _, name := range info.RequiredParams {
+		field := values.FieldByName(name)
+		switch field.Kind() {
+		case reflect.String:
+			if field.String() == "" {
+				return errors.Errorf("script parameter %s is required", name)
+			}
+		case reflect.Int:
+			if field.Int() <= 0 {
+				return errors.Errorf("script parameter %s must be positive", name)
+			}
+		default:
+			return errors.Errorf("required parameter %s of template %s is not a string or number of %T", name, info.Name, p)
+		}
+	}
+	return nil
+}
+
+var funcs = template.FuncMap{
+	"shellQuote": ShellQuote,
+}
+
+// ShellQuote returns v as a single shell word, quoted so that the shell takes it literally
+func ShellQuote(v interface{}) string {
+	return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", `'\''`) + "'"
+}
+
+// Render validates params and renders them into their template of the default catalog.
+// Referencing a parameter the struct does not have is an error instead of an empty value.
+func Render(params Params) ([]byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	name := params.TemplateName()
+	tpl, err := DefaultCatalog().Load(name)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, params); err != nil {
+		return nil, errors.Wrapf(err, "failed to render script template %s", name)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,148 @@
+package script
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestRenderGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		params Params
+	}{
+		{
+			golden: "kubevirt-create.golden",
+			params: KubeVirtCreateParams{
+				ClusterName:               "demo",
+				ClusterNamespace:          "demo-abc123",
+				KubernetesVersion:         "1.31.0",
+				AdminClusterKubeconfig:    "apiVersion: v1\nkind: Config\ncurrent-context: 'hub'\n",
+				ControlPlaneMachineCount:  3,
+				ControlPlaneMachineCPU:    2,
+				ControlPlaneMachineMemory: 4,
+				WorkerMachineCount:        2,
+				WorkerMachineCPU:          4,
+				WorkerMachineMemory:       8,
+				WorkerPoolsBase64:         "W3sibmFtZSI6Im1kLTAifV0=",
+			},
+		},
+		{
+			golden: "kubevirt-kamaji-create.golden",
+			params: KubeVirtKamajiCreateParams{
+				ClusterName:            "demo",
+				ClusterNamespace:       "demo-abc123",
+				KubernetesVersion:      "1.31.0",
+				AdminClusterKubeconfig: "apiVersion: v1\nkind: Config\ncurrent-context: 'hub'\n",
+				WorkerMachineCount:     2,
+				WorkerMachineCPU:       4,
+				WorkerMachineMemory:    8,
+				WorkerPoolsBase64:      "W3sibmFtZSI6Im1kLTAifV0=",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			got, err := Render(tt.params)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read golden file, run the test with -update to create it: %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("Render() does not match %s, run the test with -update if the change is intended\n--- got\n%s", path, got)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		params Params
+		want   string
+	}{
+		{
+			name:   "first missing parameter of the catalog order",
+			params: KubeVirtCreateParams{ClusterName: "demo", WorkerPoolsBase64: "W10="},
+			want:   "script parameter ClusterNamespace is required",
+		},
+		{
+			name: "number that is not positive",
+			params: KubeVirtKamajiCreateParams{
+				ClusterName: "demo", ClusterNamespace: "demo-abc123", KubernetesVersion: "1.31.0",
+				AdminClusterKubeconfig: "kubeconfig", WorkerMachineMemory: 8, WorkerPoolsBase64: "W10=",
+			},
+			want: "script parameter WorkerMachineCPU must be positive",
+		},
+		{
+			name:   "complete",
+			params: KubeVirtDeleteParams{ClusterName: "demo", ClusterNamespace: "demo-delete-abc123", AdminClusterKubeconfig: "kubeconfig"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the same parameter is reported on every run
+			for i := 0; i < 10; i++ {
+				err := tt.params.Validate()
+				got := ""
+				if err != nil {
+					got = err.Error()
+				}
+				if got != tt.want {
+					t.Fatalf("Validate() = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{in: "plain", want: `'plain'`},
+		{in: "", want: `''`},
+		{in: "with space", want: `'with space'`},
+		{in: "it's", want: `'it'\''s'`},
+		{in: `"double"`, want: `'"double"'`},
+		{in: "$HOME and $(id)", want: `'$HOME and $(id)'`},
+		{in: "line1\nline2", want: "'line1\nline2'"},
+		{in: 42, want: `'42'`},
+	}
+	for _, tt := range tests {
+		if got := ShellQuote(tt.in); got != tt.want {
+			t.Errorf("ShellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestShellQuoteRoundTrip(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to run the quoted words")
+	}
+	for _, in := range []string{"it's", `"double" and 'single'`, "$HOME `id` $(id)", "tab\tand\nnewline", "a\\b"} {
+		out, err := exec.Command(sh, "-c", "printf '%s' "+ShellQuote(in)).Output()
+		if err != nil {
+			t.Fatalf("sh failed for %q: %v", in, err)
+		}
+		if string(out) != in {
+			t.Errorf("sh read %q back as %q", in, out)
+		}
+	}
+}
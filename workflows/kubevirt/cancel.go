@@ -0,0 +1,120 @@
+package kubevirt
+
+import (
+	"fmt"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
+	"github.com/go-logr/logr"
+	"github.com/indeedeng/iwf-golang-sdk/gen/iwfidl"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+// CancelProvisionSignal aborts the provisioning of a cluster, its value is the reason recorded in cleanup_reason
+const CancelProvisionSignal = "CancelProvision"
+
+// provisionedChannel is published once the cluster is provisioned, it releases cancelProvisionState
+const provisionedChannel = "provisioned"
+
+// provisionStoppedChannel is published by the provisioning state that stops for a cancel
+const provisionStoppedChannel = "provision_stopped"
+
+// cancelRequestedAttribute holds the cleanup reason of a cancel until the provisioning states stopped
+const cancelRequestedAttribute = "cancel_requested"
+
+// CleanupReasonCancelled prefixes the cleanup_reason of a cancelled provisioning
+const CleanupReasonCancelled = "cancelled"
+
+// cancelProvisionState runs next to the provisioning states until the cluster is provisioned. When the cancel
+// signal arrives first it records the cancel, the provisioning states stop at their next execution and
+// stopProvisionState compensates once they did.
+type cancelProvisionState struct {
+	iwf.WorkflowStateDefaults
+	svc service.ClusterCreateService
+}
+
+func (i cancelProvisionState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, nil)
+}
+
+func (i cancelProvisionState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	return iwf.AnyCommandCompletedRequest(
+		iwf.NewSignalCommand("", CancelProvisionSignal),
+		iwf.NewInternalChannelCommand("", provisionedChannel),
+	), nil
+}
+
+func (i cancelProvisionState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	result := commandResults.GetSignalCommandResultByChannel(CancelProvisionSignal)
+	if result == nil || result.Status != iwfidl.RECEIVED {
+		return iwf.DeadEnd, nil
+	}
+	var reason string
+	result.SignalValue.Get(&reason)
+	cleanupReason := CleanupReasonCancelled
+	if reason != "" {
+		cleanupReason = fmt.Sprintf("%s: %s", CleanupReasonCancelled, reason)
+	}
+
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info(fmt.Sprintf("Cancelling cluster creation: %s", cleanupReason))
+
+	persistence.SetDataAttribute(cancelRequestedAttribute, cleanupReason)
+	reportStateStatus(ctx, persistence, "cancelProvisionState", "stopping", map[string]interface{}{"reason": reason})
+	return iwf.SingleNextState(&stopProvisionState{svc: i.svc}, input), nil
+}
+
+// stopProvisionState waits until the provisioning states stopped for a cancel, so the compensations never run
+// while a state still creates what they remove. A cluster that was provisioned in the meantime is kept.
+type stopProvisionState struct {
+	iwf.WorkflowStateDefaults
+	svc service.ClusterCreateService
+}
+
+func (i stopProvisionState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, nil)
+}
+
+func (i stopProvisionState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	return iwf.AnyCommandCompletedRequest(
+		iwf.NewInternalChannelCommand("", provisionStoppedChannel),
+		iwf.NewInternalChannelCommand("", provisionedChannel),
+	), nil
+}
+
+func (i stopProvisionState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	result := commandResults.GetInternalChannelCommandResultByChannel(provisionStoppedChannel)
+	if result == nil || result.Status != iwfidl.RECEIVED {
+		reportStateStatus(ctx, persistence, "stopProvisionState", "skipped", map[string]interface{}{
+			"reason": "the cluster was provisioned before the cancel took effect",
+		})
+		return iwf.DeadEnd, nil
+	}
+
+	var cleanupReason string
+	persistence.GetDataAttribute(cancelRequestedAttribute, &cleanupReason)
+	// the cleanup reason is persisted with the decision, so a retry knows the run was compensated
+	persistence.SetDataAttribute("cleanup_reason", cleanupReason)
+	return iwf.SingleNextState(&compensateProvisionState{svc: i.svc}, input), nil
+}
+
+// stopForCancel is called by the provisioning states before they do anything. Once a cancel was requested it
+// releases stopProvisionState and reports true, the state then ends its thread with a dead end.
+func stopForCancel(p iwf.Persistence, communication iwf.Communication) bool {
+	var cleanupReason string
+	p.GetDataAttribute(cancelRequestedAttribute, &cleanupReason)
+	if cleanupReason == "" {
+		return false
+	}
+	communication.PublishInternalChannel(provisionStoppedChannel, nil)
+	return true
+}
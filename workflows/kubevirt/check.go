@@ -0,0 +1,40 @@
+package kubevirt
+
+import (
+	"time"
+
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+// checkDeadlineAttribute holds when the running check state gives up. A check state looks at something that takes
+// minutes, a capi-runner Job or a CAPI rollout, once per execution and moves back to itself until it is done. Its
+// WaitUntil waits on a timer on the iWF server between two checks, so no worker call is held open meanwhile, and
+// the deadline survives worker restarts. A check state clears it when it leaves, clusterEntityState clears it for
+// one that a failure left.
+const checkDeadlineAttribute = "check_deadline"
+
+// nextCheck is the WaitUntil of a check state: the first check runs right away, every further one after interval
+func nextCheck(p iwf.Persistence, interval time.Duration) *iwf.CommandRequest {
+	var deadline time.Time
+	p.GetDataAttribute(checkDeadlineAttribute, &deadline)
+	if deadline.IsZero() {
+		return iwf.EmptyCommandRequest()
+	}
+	return iwf.AllCommandsCompletedRequest(iwf.NewTimerCommandByDuration("", interval))
+}
+
+// checkDeadline returns when the running check gives up, the first check starts it timeout from now
+func checkDeadline(p iwf.Persistence, timeout time.Duration) time.Time {
+	var deadline time.Time
+	p.GetDataAttribute(checkDeadlineAttribute, &deadline)
+	if deadline.IsZero() {
+		deadline = time.Now().Add(timeout)
+		p.SetDataAttribute(checkDeadlineAttribute, deadline)
+	}
+	return deadline
+}
+
+// endCheck clears the deadline, so the next check state starts with one of its own
+func endCheck(p iwf.Persistence) {
+	p.SetDataAttribute(checkDeadlineAttribute, time.Time{})
+}
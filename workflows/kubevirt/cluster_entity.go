@@ -0,0 +1,142 @@
+package kubevirt
+
+import (
+	"fmt"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
+	"github.com/go-logr/logr"
+	"github.com/indeedeng/iwf-golang-sdk/gen/iwfidl"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+// Day-2 commands delivered to a provisioned cluster's workflow
+const (
+	ScaleClusterSignal     = "ScaleCluster"
+	UpgradeClusterSignal   = "UpgradeCluster"
+	RotateKubeconfigSignal = "RotateKubeconfig"
+	DeleteClusterSignal    = "DeleteCluster"
+)
+
+func clusterCommandSignals() []string {
+	return []string{ScaleClusterSignal, UpgradeClusterSignal, RotateKubeconfigSignal, DeleteClusterSignal}
+}
+
+// backToEntity ends a day-2 operation, however it ended: the cluster workflow goes back to waiting for the next
+// command. A failed step reports its error in the status attributes before it hands control back.
+func backToEntity() *iwf.StateDecision {
+	return iwf.SingleNextState(&clusterEntityState{}, nil)
+}
+
+// clusterEntityState is where a provisioned cluster's workflow rests. Its WaitUntil waits on the command signals
+// on the iWF server, so no worker goroutine is held while the cluster is idle.
+type clusterEntityState struct {
+	iwf.WorkflowStateDefaults
+	svc service.ClusterCreateService
+}
+
+func (i clusterEntityState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, nil)
+}
+
+func (i clusterEntityState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	var commands []iwf.Command
+	for _, signal := range clusterCommandSignals() {
+		commands = append(commands, iwf.NewSignalCommand("", signal))
+	}
+	var upgrading bool
+	persistence.GetDataAttribute("upgrading", &upgrading)
+	if upgrading {
+		// an upgrade just handed control back, however it ended
+		persistence.SetDataAttribute("upgrading", false)
+		persistence.SetDataAttribute("paused", false)
+		communication.PublishInternalChannel(upgradeEndedChannel, nil)
+	}
+	// a check state that a failure handed back here left its deadline
+	endCheck(persistence)
+	reportStateStatus(ctx, persistence, "clusterEntityState", "ready", nil)
+	return iwf.AnyCommandCompletedRequest(commands...), nil
+}
+
+func (i clusterEntityState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	var nsname string
+	persistence.GetDataAttribute("nsname", &nsname)
+	var cluster common.KubeVirtCreateOperation
+	persistence.GetDataAttribute("cluster", &cluster)
+	clusterName := cluster.CAPIConfig.ClusterName
+
+	for _, signal := range clusterCommandSignals() {
+		result := commandResults.GetSignalCommandResultByChannel(signal)
+		if result == nil || result.Status != iwfidl.RECEIVED {
+			continue
+		}
+		logger.Info(fmt.Sprintf("Received %s command for cluster %s", signal, clusterName))
+
+		switch signal {
+		case ScaleClusterSignal:
+			var cfg common.ClusterScaleConfig
+			result.SignalValue.Get(&cfg)
+			cfg.ClusterName, cfg.InfraNamespace = clusterName, nsname
+			return iwf.SingleNextState(&scaleMachineDeploymentState{}, common.KubeVirtScaleOperation{
+				KubeVirtCredential: cluster.KubeVirtCredential,
+				ScaleConfig:        cfg,
+			}), nil
+		case UpgradeClusterSignal:
+			var cfg common.ClusterUpgradeConfig
+			result.SignalValue.Get(&cfg)
+			cfg.ClusterName, cfg.InfraNamespace = clusterName, nsname
+			return iwf.SingleNextState(&validateUpgradeState{}, common.KubeVirtUpgradeOperation{
+				KubeVirtCredential: cluster.KubeVirtCredential,
+				UpgradeConfig:      cfg,
+			}), nil
+		case RotateKubeconfigSignal:
+			return iwf.SingleNextState(&rotateKubeconfigState{svc: i.svc}, nil), nil
+		case DeleteClusterSignal:
+			return iwf.SingleNextState(&createDeleteNamespaceState{}, common.KubeVirtDeleteOperation{
+				KubeVirtCredential: cluster.KubeVirtCredential,
+				DeleteConfig: common.ClusterDeleteConfig{
+					ClusterName:    clusterName,
+					InfraNamespace: nsname,
+					OwnerID:        cluster.ImportOption.BasicInfo.OwnerID,
+				},
+			}), nil
+		}
+	}
+	return iwf.SingleNextState(&clusterEntityState{svc: i.svc}, nil), nil
+}
+
+type rotateKubeconfigState struct {
+	iwf.WorkflowStateDefaultsNoWaitUntil
+	svc service.ClusterCreateService
+}
+
+func (i rotateKubeconfigState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, nil)
+}
+
+func (i rotateKubeconfigState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info("Rotating Cluster Kubeconfig")
+
+	var nsname string
+	persistence.GetDataAttribute("nsname", &nsname)
+	var cluster common.KubeVirtCreateOperation
+	persistence.GetDataAttribute("cluster", &cluster)
+
+	if err := i.svc.RotateKubeconfig(ctx, cluster.KubeVirtCredential.KubeConfig, cluster, nsname); err != nil {
+		logger.Error(err, "failed to rotate kubeconfig")
+		reportStateStatus(ctx, persistence, "rotateKubeconfigState", "failed", map[string]interface{}{"error": err.Error()})
+		return iwf.SingleNextState(&clusterEntityState{svc: i.svc}, nil), nil
+	}
+	reportStateStatus(ctx, persistence, "rotateKubeconfigState", "success", map[string]interface{}{"nsname": nsname})
+	return iwf.SingleNextState(&clusterEntityState{svc: i.svc}, nil), nil
+}
@@ -0,0 +1,126 @@
+package kubevirt
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
+	"github.com/go-logr/logr"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+// CompensationsAttribute lists the compensations registered by the provisioning states, in the order they were
+// registered. It is emptied once they ran.
+const CompensationsAttribute = "compensations"
+
+// Compensations undo one step of provisioning, every one of them tolerates what is already gone
+const (
+	compensateNamespace    = "deleteNamespace"
+	compensateScriptSecret = "deleteScriptSecret"
+	compensateJob          = "deleteJob"
+	compensateCAPICluster  = "deleteCAPICluster"
+)
+
+// registerCompensations adds names to the compensations of the workflow. They are persisted together with the
+// state's decision, so a state registers what it created only once it succeeded; whatever a failed state left
+// behind lives in the namespace and goes away with it.
+func registerCompensations(p iwf.Persistence, names ...string) {
+	var registered []string
+	p.GetDataAttribute(CompensationsAttribute, &registered)
+	for _, name := range names {
+		if !slices.Contains(registered, name) {
+			registered = append(registered, name)
+		}
+	}
+	p.SetDataAttribute(CompensationsAttribute, registered)
+}
+
+// runCompensations runs names in reverse order and reports each of them under "compensation/<name>". It stops
+// at the first compensation that fails, a retried state runs them all again.
+func runCompensations(
+	ctx iwf.WorkflowContext, p iwf.Persistence, svc service.ClusterCreateService, names []string,
+	operation common.KubeVirtCreateOperation, nsname string,
+) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	for i := len(names) - 1; i >= 0; i-- {
+		name := names[i]
+		logger.Info(fmt.Sprintf("Running compensation %s for namespace (%s)", name, nsname))
+
+		var err error
+		switch name {
+		case compensateCAPICluster:
+			err = svc.DeleteCAPICluster(ctx, operation.KubeVirtCredential.KubeConfig, operation, nsname)
+		case compensateJob:
+			err = svc.DeleteJob(ctx, nsname)
+		case compensateScriptSecret:
+			err = svc.DeleteScriptSecret(ctx, nsname)
+		case compensateNamespace:
+			err = svc.CleanupNamespace(ctx, nsname)
+		default:
+			err = fmt.Errorf("unknown compensation %q", name)
+		}
+		if err != nil {
+			reportStateStatus(ctx, p, "compensation/"+name, "failed", map[string]interface{}{"error": err.Error()})
+			return err
+		}
+		reportStateStatus(ctx, p, "compensation/"+name, "compensated", map[string]interface{}{"nsname": nsname})
+	}
+	return nil
+}
+
+// CleanupReasonFailed is the cleanup_reason of a provisioning that is compensated because it failed
+const CleanupReasonFailed = "failed"
+
+// compensateProvision moves a provisioning that retrying cannot fix, like a failed creation script, to
+// compensateProvisionState. The cleanup reason is persisted with the decision, so a retry of the workflow knows
+// the run was compensated even when a compensation fails.
+func compensateProvision(p iwf.Persistence, svc service.ClusterCreateService, input iwf.Object) *iwf.StateDecision {
+	p.SetDataAttribute("cleanup_reason", CleanupReasonFailed)
+	return iwf.SingleNextState(&compensateProvisionState{svc: svc}, input)
+}
+
+// compensateProvisionState undoes a failed or cancelled provisioning by running the registered compensations in
+// reverse order, and then fails the workflow with the cleanup reason. A retry of a compensated workflow
+// provisions the cluster from scratch.
+type compensateProvisionState struct {
+	iwf.WorkflowStateDefaultsNoWaitUntil
+	svc service.ClusterCreateService
+}
+
+func (i compensateProvisionState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, nil)
+}
+
+func (i compensateProvisionState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	var nsname string
+	persistence.GetDataAttribute("nsname", &nsname)
+	var cleanupReason string
+	persistence.GetDataAttribute("cleanup_reason", &cleanupReason)
+	if cleanupReason == "" {
+		cleanupReason = CleanupReasonFailed
+	}
+	status := CleanupReasonFailed
+	if strings.HasPrefix(cleanupReason, CleanupReasonCancelled) {
+		status = CleanupReasonCancelled
+	}
+	var registered []string
+	persistence.GetDataAttribute(CompensationsAttribute, &registered)
+	var operation common.KubeVirtCreateOperation
+	input.Get(&operation)
+
+	if err := runCompensations(ctx, persistence, i.svc, registered, operation, nsname); err != nil {
+		return nil, err
+	}
+
+	persistence.SetDataAttribute(CompensationsAttribute, []string{})
+	reportStateStatus(ctx, persistence, "compensateProvisionState", status, map[string]interface{}{
+		"compensations": registered,
+		"logs":          jobLogTail(ctx),
+	})
+	return iwf.ForceFailWorkflow(fmt.Sprintf("Cluster creation %s, provisioning compensated.", cleanupReason)), nil
+}
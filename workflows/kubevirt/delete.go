@@ -0,0 +1,296 @@
+package kubevirt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
+	"github.com/go-logr/logr"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+	"time"
+)
+
+// deleteNamespaceAttribute holds the namespace the deletion Job runs in. It is apart from the runner namespace of
+// provisioning, which the cluster workflow keeps while it deletes the cluster.
+const deleteNamespaceAttribute = "delete_nsname"
+
+// deleteResultAttribute holds how the deletion ended until cleanupDeleteNamespaceState removed the namespace. It is
+// apart from cleanup_reason, which keeps the outcome of provisioning until the cluster is deleted.
+const deleteResultAttribute = "delete_result"
+
+type createDeleteNamespaceState struct {
+	iwf.WorkflowStateDefaults
+	svc service.ClusterDeleteService
+}
+
+func (i createDeleteNamespaceState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &deleteFailedState{svc: i.svc})
+}
+
+// WaitUntil picks the name of the namespace once, so every attempt of Execute creates the same namespace. A new
+// deletion also drops the output of the provisioning Job and of earlier deletions.
+func (i createDeleteNamespaceState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	var nsname string
+	persistence.GetDataAttribute(deleteNamespaceAttribute, &nsname)
+	if nsname == "" {
+		clearJobLogs(ctx)
+		var operation common.KubeVirtDeleteOperation
+		input.Get(&operation)
+		persistence.SetDataAttribute(deleteNamespaceAttribute, common.DeleteNamespaceName(operation.DeleteConfig.ClusterName))
+	}
+	return iwf.EmptyCommandRequest(), nil
+}
+
+func (i createDeleteNamespaceState) Execute(
+	ctx iwf.WorkflowContext,
+	input iwf.Object,
+	commandResults iwf.CommandResults,
+	persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	var nsname string
+	persistence.GetDataAttribute(deleteNamespaceAttribute, &nsname)
+
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info(fmt.Sprintf("Creating Namespace: (%s)", nsname))
+
+	if err := i.svc.CreateNamespace(ctx, nsname); err != nil {
+		reportStateStatus(ctx, persistence, "createDeleteNamespaceState", "failed", map[string]interface{}{"error": err.Error()})
+		return nil, err
+	}
+	reportStateStatus(ctx, persistence, "createDeleteNamespaceState", "success", map[string]interface{}{"nsname": nsname})
+	return iwf.SingleNextState(&createDeleteJobState{svc: i.svc}, input), nil
+}
+
+type createDeleteJobState struct {
+	iwf.WorkflowStateDefaultsNoWaitUntil
+	svc service.ClusterDeleteService
+}
+
+func (i createDeleteJobState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &deleteFailedState{svc: i.svc})
+}
+
+func (i createDeleteJobState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info("Creating Job To Run Cluster Deletion Script")
+
+	var nsname string
+	persistence.GetDataAttribute(deleteNamespaceAttribute, &nsname)
+
+	var operation common.KubeVirtDeleteOperation
+	input.Get(&operation)
+	if err := i.svc.CreateJob(ctx, operation, nsname); err != nil {
+		reportStateStatus(ctx, persistence, "createDeleteJobState", "failed", map[string]interface{}{"error": err.Error()})
+		if errors.Is(err, common.ErrNoRunnerImage) {
+			// retrying cannot help until the worker is configured with an image
+			persistence.SetDataAttribute(deleteResultAttribute, "failed")
+			return iwf.SingleNextState(&cleanupDeleteNamespaceState{svc: i.svc}, input), nil
+		}
+		return nil, err
+	}
+	reportStateStatus(ctx, persistence, "createDeleteJobState", "success", map[string]interface{}{"nsname": nsname})
+	return iwf.SingleNextState(&clusterDeletionCheckState{svc: i.svc}, input), nil
+}
+
+// clusterDeletionCheckState checks the deletion Job once per execution like clusterOperationSuccessfulCheckState
+// checks the creation Job
+type clusterDeletionCheckState struct {
+	iwf.WorkflowStateDefaults
+	svc service.ClusterDeleteService
+}
+
+func (i clusterDeletionCheckState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &deleteFailedState{svc: i.svc})
+}
+
+func (i clusterDeletionCheckState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	return nextCheck(persistence, service.RetryInterval), nil
+}
+
+func (i clusterDeletionCheckState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info("Checking Cluster Deletion Job")
+
+	var nsname string
+	persistence.GetDataAttribute(deleteNamespaceAttribute, &nsname)
+	deadline := checkDeadline(persistence, service.RetryTimeout)
+
+	i.svc.StreamJobLogs(ctx.GetWorkflowId(), nsname)
+	done, err := i.svc.CheckClusterOperation(ctx, nsname)
+	if err != nil && !errors.Is(err, service.ErrJobFailed) {
+		// the Job could not be read, the iWF server retries the check
+		return nil, err
+	}
+	if err == nil && !done {
+		if time.Now().Before(deadline) {
+			return iwf.SingleNextState(&clusterDeletionCheckState{svc: i.svc}, input), nil
+		}
+		err = fmt.Errorf("cluster deletion job did not finish within %s", service.RetryTimeout)
+	}
+	i.svc.WaitForJobLogs(ctx.GetWorkflowId())
+	endCheck(persistence)
+	if err != nil {
+		logger.Error(err, "failed to delete cluster")
+		persistence.SetDataAttribute(deleteResultAttribute, "failed")
+		reportStateStatus(ctx, persistence, "clusterDeletionCheck", "failed", map[string]interface{}{"error": err.Error(), "logs": jobLogTail(ctx)})
+		return iwf.SingleNextState(&cleanupDeleteNamespaceState{svc: i.svc}, input), nil
+	}
+
+	reportStateStatus(ctx, persistence, "clusterDeletionCheck", "success", map[string]interface{}{"nsname": nsname})
+	return iwf.SingleNextState(&waitForClusterDeletionState{svc: i.svc}, input), nil
+}
+
+// waitForClusterDeletionState checks once per execution whether CAPI removed the cluster from the hub, it is a
+// check state like clusterDeletionCheckState
+type waitForClusterDeletionState struct {
+	iwf.WorkflowStateDefaults
+	svc service.ClusterDeleteService
+}
+
+func (i waitForClusterDeletionState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &deleteFailedState{svc: i.svc})
+}
+
+func (i waitForClusterDeletionState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	return nextCheck(persistence, common.RetryInterval), nil
+}
+
+func (i waitForClusterDeletionState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	var operation common.KubeVirtDeleteOperation
+	input.Get(&operation)
+	infraNamespace := operation.DeleteConfig.InfraNamespace
+
+	deadline := checkDeadline(persistence, common.ClusterDeletionTimeout)
+	deleted, err := i.svc.CheckClusterDeleted(ctx, operation)
+	if err != nil {
+		// the hub could not be reached, the iWF server retries the check
+		return nil, err
+	}
+	if !deleted {
+		if time.Now().Before(deadline) {
+			return iwf.SingleNextState(&waitForClusterDeletionState{svc: i.svc}, input), nil
+		}
+		err = fmt.Errorf("cluster was not removed from the hub within %s", common.ClusterDeletionTimeout)
+	}
+	endCheck(persistence)
+	if err != nil {
+		logger.Error(err, "cluster was not removed from the hub")
+		persistence.SetDataAttribute(deleteResultAttribute, "failed")
+		reportStateStatus(ctx, persistence, "waitForClusterDeletionState", "failed", map[string]interface{}{"error": err.Error()})
+		return iwf.SingleNextState(&cleanupDeleteNamespaceState{svc: i.svc}, input), nil
+	}
+
+	logger.Info("Successfully Deleted Cluster")
+	persistence.SetDataAttribute(deleteResultAttribute, "success")
+	reportStateStatus(ctx, persistence, "waitForClusterDeletionState", "success", map[string]interface{}{"infraNamespace": infraNamespace})
+	return iwf.SingleNextState(&cleanupDeleteNamespaceState{svc: i.svc}, input), nil
+}
+
+type cleanupDeleteNamespaceState struct {
+	iwf.WorkflowStateDefaultsNoWaitUntil
+	svc service.ClusterDeleteService
+}
+
+func (i cleanupDeleteNamespaceState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &deleteFailedState{svc: i.svc})
+}
+
+func (i cleanupDeleteNamespaceState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	var nsname string
+	persistence.GetDataAttribute(deleteNamespaceAttribute, &nsname)
+	var result string
+	persistence.GetDataAttribute(deleteResultAttribute, &result)
+
+	if err := i.svc.CleanupNamespace(ctx, nsname); err != nil {
+		logger.Error(err, "failed to cleanup namespace")
+		reportStateStatus(ctx, persistence, "cleanupDeleteNamespaceState", "failed", map[string]interface{}{"error": err.Error()})
+		return nil, err
+	}
+	if result != "failed" {
+		// the kubeconfig of a deleted cluster must not be handed out any more
+		var operation common.KubeVirtDeleteOperation
+		input.Get(&operation)
+		if err := i.svc.DeleteClusterKubeconfig(ctx, operation); err != nil {
+			logger.Error(err, "failed to delete cluster kubeconfig")
+			reportStateStatus(ctx, persistence, "cleanupDeleteNamespaceState", "failed", map[string]interface{}{"error": err.Error()})
+			return nil, err
+		}
+	}
+	reportStateStatus(ctx, persistence, "cleanupDeleteNamespaceState", result, map[string]interface{}{"nsname": nsname})
+	if result == "failed" {
+		// the cluster is still there, its workflow keeps serving commands and a new delete starts over
+		resetDeleteAttributes(persistence)
+		return backToEntity(), nil
+	}
+	// a new provisioning of the same cluster name may start over this run
+	persistence.SetDataAttribute("cleanup_reason", CleanupReasonDeleted)
+	return iwf.GracefulCompletingWorkflow, nil
+}
+
+// resetDeleteAttributes forgets a deletion that ended, so the next delete command picks a new namespace and
+// waits for its Job from a new deadline
+func resetDeleteAttributes(p iwf.Persistence) {
+	p.SetDataAttribute(deleteNamespaceAttribute, "")
+	p.SetDataAttribute(deleteResultAttribute, "")
+	endCheck(p)
+}
+
+// deleteFailedState is where a deletion state goes once the iWF server gave up retrying it. It records the error,
+// removes the namespace of the deletion Job if it can and hands control back to clusterEntityState, so a failed
+// deletion never ends the cluster's workflow.
+type deleteFailedState struct {
+	iwf.WorkflowStateDefaultsNoWaitUntil
+	svc service.ClusterDeleteService
+}
+
+func (i deleteFailedState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, nil)
+}
+
+func (i deleteFailedState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	var nsname string
+	persistence.GetDataAttribute(deleteNamespaceAttribute, &nsname)
+	data := map[string]interface{}{
+		"error":  "cluster deletion failed after its last retry",
+		"nsname": nsname,
+	}
+	if err := i.svc.CleanupNamespace(ctx, nsname); err != nil {
+		// the namespace is kept, the next delete command runs in it and removes it
+		logger.Error(err, "failed to cleanup namespace")
+		data["cleanupError"] = err.Error()
+		persistence.SetDataAttribute(deleteResultAttribute, "")
+		endCheck(persistence)
+	} else {
+		resetDeleteAttributes(persistence)
+	}
+	reportStateStatus(ctx, persistence, "deleteFailedState", "failed", data)
+	return backToEntity(), nil
+}
@@ -0,0 +1,134 @@
+package kubevirt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/persistence"
+	"github.com/go-logr/logr"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+// ProgressAttribute holds the ScriptProgress of the running capi-runner script
+const ProgressAttribute = "progress"
+
+// progressLevel is the log() type of the marker lines written by the step() function of the scripts.
+// The script first declares its plan with `steps=a,b,c` and then logs `step=<name> status=<started|succeeded|failed>`.
+const progressLevel = "PROGRESS"
+
+// Statuses of a script step
+const (
+	StepPending   = "pending"
+	StepStarted   = "started"
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+)
+
+// StepProgress is one phase of a capi-runner script
+type StepProgress struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	StartedAt  string `json:"startedAt,omitempty"`
+	FinishedAt string `json:"finishedAt,omitempty"`
+}
+
+// ScriptProgress is the progress of a capi-runner script built from its PROGRESS marker lines
+type ScriptProgress struct {
+	Steps   []StepProgress `json:"steps"`
+	Percent int            `json:"percent"`
+}
+
+// ParseScriptProgress builds the progress of a script from its stored log lines. Only the lines of the newest pod
+// count, the steps of a failed pod are run again by the pod that replaces it.
+func ParseScriptProgress(lines []persistence.LogLine) ScriptProgress {
+	var progress ScriptProgress
+	index := map[string]int{}
+	for _, line := range lastPodLines(lines) {
+		if line.Level != progressLevel {
+			continue
+		}
+		fields := map[string]string{}
+		for _, kv := range strings.Fields(line.Message) {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				fields[k] = v
+			}
+		}
+
+		if plan, ok := fields["steps"]; ok {
+			for _, name := range strings.Split(plan, ",") {
+				if _, seen := index[name]; !seen {
+					index[name] = len(progress.Steps)
+					progress.Steps = append(progress.Steps, StepProgress{Name: name, Status: StepPending})
+				}
+			}
+			continue
+		}
+
+		name, status := fields["step"], fields["status"]
+		if name == "" || status == "" {
+			continue
+		}
+		i, seen := index[name]
+		if !seen {
+			i = len(progress.Steps)
+			index[name] = i
+			progress.Steps = append(progress.Steps, StepProgress{Name: name})
+		}
+		step := &progress.Steps[i]
+		step.Status = status
+		if status == StepStarted {
+			step.StartedAt = line.Time
+		} else {
+			step.FinishedAt = line.Time
+		}
+	}
+
+	if len(progress.Steps) > 0 {
+		done := 0
+		for _, step := range progress.Steps {
+			if step.Status == StepSucceeded {
+				done++
+			}
+		}
+		progress.Percent = done * 100 / len(progress.Steps)
+	}
+	return progress
+}
+
+// lastPodLines returns the trailing lines written by the same pod as the last line
+func lastPodLines(lines []persistence.LogLine) []persistence.LogLine {
+	start := len(lines)
+	for start > 0 && lines[start-1].Pod == lines[len(lines)-1].Pod {
+		start--
+	}
+	return lines[start:]
+}
+
+// reportScriptProgress reads the progress of the workflow's capi-runner script, records every step that changed
+// since the last call with reportStateStatus and keeps the ProgressAttribute up to date.
+func reportScriptProgress(ctx iwf.WorkflowContext, p iwf.Persistence, stateName string) {
+	lines, err := persistence.GetLogs(ctx, ctx.GetWorkflowId())
+	if err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "failed to read job logs")
+		return
+	}
+	progress := ParseScriptProgress(lines)
+
+	var previous ScriptProgress
+	p.GetDataAttribute(ProgressAttribute, &previous)
+	reported := map[string]string{}
+	for _, step := range previous.Steps {
+		reported[step.Name] = step.Status
+	}
+	for _, step := range progress.Steps {
+		if step.Status == StepPending || reported[step.Name] == step.Status {
+			continue
+		}
+		reportStateStatus(ctx, p, fmt.Sprintf("%s/%s", stateName, step.Name), step.Status, map[string]interface{}{
+			"startedAt":  step.StartedAt,
+			"finishedAt": step.FinishedAt,
+			"percent":    progress.Percent,
+		})
+	}
+	p.SetDataAttribute(ProgressAttribute, progress)
+}
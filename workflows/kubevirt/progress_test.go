@@ -0,0 +1,100 @@
+package kubevirt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/persistence"
+)
+
+func progressLine(time, message string) persistence.LogLine {
+	return persistence.LogLine{Time: time, Script: "create", Level: progressLevel, Message: message}
+}
+
+func podLine(pod string, line persistence.LogLine) persistence.LogLine {
+	line.Pod = pod
+	return line
+}
+
+func TestParseScriptProgress(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []persistence.LogLine
+		want  ScriptProgress
+	}{
+		{
+			name:  "no marker lines",
+			lines: []persistence.LogLine{{Level: "INFO", Message: "step=apply status=started"}, {Message: "plain output"}},
+			want:  ScriptProgress{},
+		},
+		{
+			name:  "plan only",
+			lines: []persistence.LogLine{progressLine("t0", "steps=apply,wait,kubeconfig")},
+			want: ScriptProgress{Steps: []StepProgress{
+				{Name: "apply", Status: StepPending},
+				{Name: "wait", Status: StepPending},
+				{Name: "kubeconfig", Status: StepPending},
+			}},
+		},
+		{
+			name: "steps of the plan",
+			lines: []persistence.LogLine{
+				progressLine("t0", "steps=apply,wait"),
+				progressLine("t1", "step=apply status=started"),
+				{Level: "INFO", Message: "applying the cluster"},
+				progressLine("t2", "step=apply status=succeeded"),
+				progressLine("t3", "step=wait status=started"),
+			},
+			want: ScriptProgress{Percent: 50, Steps: []StepProgress{
+				{Name: "apply", Status: StepSucceeded, StartedAt: "t1", FinishedAt: "t2"},
+				{Name: "wait", Status: StepStarted, StartedAt: "t3"},
+			}},
+		},
+		{
+			name: "failed step",
+			lines: []persistence.LogLine{
+				progressLine("t0", "steps=apply,wait"),
+				progressLine("t1", "step=apply status=started"),
+				progressLine("t2", "step=apply status=failed"),
+			},
+			want: ScriptProgress{Steps: []StepProgress{
+				{Name: "apply", Status: StepFailed, StartedAt: "t1", FinishedAt: "t2"},
+				{Name: "wait", Status: StepPending},
+			}},
+		},
+		{
+			name: "step outside the plan and malformed markers",
+			lines: []persistence.LogLine{
+				progressLine("t1", "step=cleanup status=started"),
+				progressLine("t2", "step=cleanup"),
+				progressLine("t3", "status=succeeded"),
+				progressLine("t4", "step=cleanup status=succeeded"),
+			},
+			want: ScriptProgress{Percent: 100, Steps: []StepProgress{
+				{Name: "cleanup", Status: StepSucceeded, StartedAt: "t1", FinishedAt: "t4"},
+			}},
+		},
+		{
+			name: "retried pod",
+			lines: []persistence.LogLine{
+				podLine("capi-runner-a", progressLine("t0", "steps=apply,wait")),
+				podLine("capi-runner-a", progressLine("t1", "step=apply status=started")),
+				podLine("capi-runner-a", progressLine("t2", "step=apply status=failed")),
+				podLine("capi-runner-b", progressLine("t3", "steps=apply,wait")),
+				podLine("capi-runner-b", progressLine("t4", "step=apply status=started")),
+			},
+			want: ScriptProgress{Steps: []StepProgress{
+				{Name: "apply", Status: StepStarted, StartedAt: "t4"},
+				{Name: "wait", Status: StepPending},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseScriptProgress(tt.lines); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseScriptProgress() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
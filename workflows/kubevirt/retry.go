@@ -0,0 +1,89 @@
+package kubevirt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+// ProvisionStateAttribute holds the ID of the provisioning state that runs next. Every provisioning state sets it
+// together with its decision, so once a run failed it names the state that failed.
+const ProvisionStateAttribute = "provision_state"
+
+// ErrCompensationPending is returned by RetryStateID while the failed run still has compensations to run
+var ErrCompensationPending = errors.New("the failed provisioning is not compensated yet")
+
+// RetryStateID returns the ID of the state a failed provisioning is retried from, judged by its data attributes.
+// A run that failed without being compensated still has its namespace and Job: it is reset to the state that
+// failed and resumes with the namespace of the failed run. A compensated run, one that was cancelled or failed
+// for good, has nothing left to resume from and provisions from createNamespaceState again; it is refused while
+// compensations of the run are pending.
+func RetryStateID(provisionState, cleanupReason string, compensations []string) (string, error) {
+	if cleanupReason == CleanupReasonFailed || strings.HasPrefix(cleanupReason, CleanupReasonCancelled) {
+		if len(compensations) > 0 {
+			return "", ErrCompensationPending
+		}
+		return stateID(createNamespaceState{}), nil
+	}
+	switch provisionState {
+	case "":
+		return stateID(createNamespaceState{}), nil
+	case stateID(clusterOperationSuccessfulCheckState{}):
+		// the check would keep the deadline of the failed run, createJobState keeps a Job that still runs and
+		// starts the check over
+		return stateID(createJobState{}), nil
+	}
+	return provisionState, nil
+}
+
+// CleanupReasonDeleted is the cleanup_reason of a cluster whose workflow deleted it
+const CleanupReasonDeleted = "deleted"
+
+// RunCleanedUp reports whether a closed run left nothing behind, judged by its data attributes: it deleted its
+// cluster, or it failed or was cancelled and all its compensations ran. Any other run may still own a namespace,
+// a Job or a CAPI Cluster, and a retry of it resumes with them.
+func RunCleanedUp(cleanupReason string, compensations []string) bool {
+	if cleanupReason == CleanupReasonDeleted {
+		return true
+	}
+	compensated := cleanupReason == CleanupReasonFailed || strings.HasPrefix(cleanupReason, CleanupReasonCancelled)
+	return compensated && len(compensations) == 0
+}
+
+// provisionFailedState is where a provisioning state goes once the iWF server gave up retrying it. The failure
+// may be transient, so nothing is compensated and the workflow can be retried from the state that failed. A
+// provisioning that is being cancelled stops here and is compensated instead.
+type provisionFailedState struct {
+	iwf.WorkflowStateDefaultsNoWaitUntil
+	svc service.ClusterCreateService
+}
+
+func (i provisionFailedState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, nil)
+}
+
+func (i provisionFailedState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	if stopForCancel(persistence, communication) {
+		return iwf.DeadEnd, nil
+	}
+	var failed string
+	persistence.GetDataAttribute(ProvisionStateAttribute, &failed)
+	if failed == "" {
+		failed = stateID(createNamespaceState{})
+	}
+	var nsname string
+	persistence.GetDataAttribute("nsname", &nsname)
+
+	reportStateStatus(ctx, persistence, "provisionFailedState", "failed", map[string]interface{}{
+		"error":  fmt.Sprintf("%s failed after its last retry", failed),
+		"state":  failed,
+		"nsname": nsname,
+	})
+	return iwf.ForceFailWorkflow(fmt.Sprintf("Cluster creation failed in %s, retry the workflow to resume it.", failed)), nil
+}
@@ -0,0 +1,92 @@
+package kubevirt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
+	"github.com/go-logr/logr"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+type scaleMachineDeploymentState struct {
+	iwf.WorkflowStateDefaultsNoWaitUntil
+	svc service.ClusterScaleService
+}
+
+func (i scaleMachineDeploymentState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &clusterEntityState{})
+}
+
+func (i scaleMachineDeploymentState) Execute(
+	ctx iwf.WorkflowContext,
+	input iwf.Object,
+	commandResults iwf.CommandResults,
+	persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	var operation common.KubeVirtScaleOperation
+	input.Get(&operation)
+	mdName := operation.ScaleConfig.MachineDeploymentName()
+
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info(fmt.Sprintf("Scaling MachineDeployment: (%s)", mdName))
+
+	if err := i.svc.ScaleMachineDeployment(ctx, operation); err != nil {
+		reportStateStatus(ctx, persistence, "scaleMachineDeploymentState", "failed", map[string]interface{}{"error": err.Error()})
+		return backToEntity(), nil
+	}
+	reportStateStatus(ctx, persistence, "scaleMachineDeploymentState", "success", map[string]interface{}{"machineDeployment": mdName})
+	return iwf.SingleNextState(&waitForMachinesReadyState{svc: i.svc}, input), nil
+}
+
+// waitForMachinesReadyState checks once per execution whether the machines of the scaled pool finished their rollout
+type waitForMachinesReadyState struct {
+	iwf.WorkflowStateDefaults
+	svc service.ClusterScaleService
+}
+
+func (i waitForMachinesReadyState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &clusterEntityState{})
+}
+
+func (i waitForMachinesReadyState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	return nextCheck(persistence, common.RetryInterval), nil
+}
+
+func (i waitForMachinesReadyState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info("Checking Machines")
+
+	var operation common.KubeVirtScaleOperation
+	input.Get(&operation)
+	mdName := operation.ScaleConfig.MachineDeploymentName()
+
+	deadline := checkDeadline(persistence, common.RetryTimeout)
+	ready, err := i.svc.CheckMachinesReady(ctx, operation)
+	if err != nil {
+		// the hub could not be reached, the iWF server retries the check
+		return nil, err
+	}
+	if !ready {
+		if time.Now().Before(deadline) {
+			return iwf.SingleNextState(&waitForMachinesReadyState{svc: i.svc}, input), nil
+		}
+		endCheck(persistence)
+		err = fmt.Errorf("machines were not ready within %s", common.RetryTimeout)
+		logger.Error(err, "machines did not become ready")
+		reportStateStatus(ctx, persistence, "waitForMachinesReadyState", "failed", map[string]interface{}{"error": err.Error()})
+		return backToEntity(), nil
+	}
+	endCheck(persistence)
+
+	logger.Info("Successfully Scaled Worker Pool")
+	reportStateStatus(ctx, persistence, "waitForMachinesReadyState", "success", map[string]interface{}{"machineDeployment": mdName})
+	return backToEntity(), nil
+}
@@ -0,0 +1,112 @@
+package kubevirt
+
+import (
+	"time"
+
+	"github.com/indeedeng/iwf-golang-sdk/gen/iwfidl"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+// stateProfile is how long the iWF server lets one WaitUntil and Execute call of a state run and how it retries a
+// failed call. WaitUntil only reads attributes and builds commands, so it gets a shorter timeout than Execute.
+type stateProfile struct {
+	timeout         time.Duration
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	maxAttempts     int32
+
+	waitUntilTimeout     time.Duration
+	waitUntilMaxAttempts int32
+}
+
+var (
+	// apiCall states make a few requests to the hub, an apiserver blip is retried quickly
+	apiCall = stateProfile{
+		timeout: 2 * time.Minute, initialInterval: time.Second, maxInterval: 30 * time.Second, maxAttempts: 10,
+		waitUntilTimeout: 30 * time.Second, waitUntilMaxAttempts: 10,
+	}
+	// remoteCall states reach the infra cluster through the credential's kubeconfig and may wait for a secret there
+	remoteCall = stateProfile{
+		timeout: 15 * time.Minute, initialInterval: 5 * time.Second, maxInterval: time.Minute, maxAttempts: 5,
+		waitUntilTimeout: time.Minute, waitUntilMaxAttempts: 5,
+	}
+)
+
+// stateProfiles assigns every state of the KubeVirt workflows its profile, keyed by state ID
+var stateProfiles = map[string]stateProfile{
+	stateID(createNamespaceState{}):                 apiCall,
+	stateID(createJobState{}):                       apiCall,
+	stateID(clusterOperationSuccessfulCheckState{}): apiCall,
+	stateID(syncCredentialState{}):                  remoteCall,
+	stateID(cleanupNamespaceState{}):                apiCall,
+	stateID(provisionFailedState{}):                 apiCall,
+	stateID(compensateProvisionState{}):             remoteCall,
+	stateID(cancelProvisionState{}):                 apiCall,
+	stateID(stopProvisionState{}):                   apiCall,
+	stateID(clusterEntityState{}):                   apiCall,
+	stateID(rotateKubeconfigState{}):                remoteCall,
+
+	stateID(scaleMachineDeploymentState{}): remoteCall,
+	stateID(waitForMachinesReadyState{}):   apiCall,
+
+	stateID(validateUpgradeState{}):            remoteCall,
+	stateID(pauseUpgradeState{}):               apiCall,
+	stateID(upgradeControlPlaneState{}):        remoteCall,
+	stateID(waitForControlPlaneUpgradeState{}): apiCall,
+	stateID(upgradeCheckpointState{}):          apiCall,
+	stateID(upgradeWorkerPoolState{}):          remoteCall,
+	stateID(waitForWorkerPoolUpgradeState{}):   apiCall,
+	stateID(upgradeFailedState{}):              apiCall,
+
+	stateID(createDeleteNamespaceState{}):  apiCall,
+	stateID(createDeleteJobState{}):        apiCall,
+	stateID(clusterDeletionCheckState{}):   apiCall,
+	stateID(waitForClusterDeletionState{}): remoteCall,
+	stateID(cleanupDeleteNamespaceState{}): apiCall,
+	stateID(deleteFailedState{}):           apiCall,
+}
+
+// MaxExecuteTimeout is the longest an Execute call of any state may run, a worker that shuts down waits this long
+// for the calls in flight
+func MaxExecuteTimeout() time.Duration {
+	var longest time.Duration
+	for _, profile := range stateProfiles {
+		if profile.timeout > longest {
+			longest = profile.timeout
+		}
+	}
+	return longest
+}
+
+func stateID(state iwf.WorkflowState) string {
+	return iwf.GetFinalWorkflowStateId(state)
+}
+
+// stateOptions returns the options of state from its profile. When proceed is set, a call that still fails after
+// the last attempt moves the workflow to proceed instead of failing it.
+func stateOptions(state iwf.WorkflowState, proceed iwf.WorkflowState) *iwf.StateOptions {
+	profile, ok := stateProfiles[stateID(state)]
+	if !ok {
+		profile = apiCall
+	}
+	return &iwf.StateOptions{
+		WaitUntilApiTimeoutSeconds:    seconds(profile.waitUntilTimeout),
+		WaitUntilApiRetryPolicy:       profile.retryPolicy(profile.waitUntilMaxAttempts),
+		ExecuteApiTimeoutSeconds:      seconds(profile.timeout),
+		ExecuteApiRetryPolicy:         profile.retryPolicy(profile.maxAttempts),
+		ExecuteApiFailureProceedState: proceed,
+	}
+}
+
+func (p stateProfile) retryPolicy(maxAttempts int32) *iwfidl.RetryPolicy {
+	return &iwfidl.RetryPolicy{
+		InitialIntervalSeconds: seconds(p.initialInterval),
+		BackoffCoefficient:     iwfidl.PtrFloat32(2),
+		MaximumIntervalSeconds: seconds(p.maxInterval),
+		MaximumAttempts:        iwfidl.PtrInt32(maxAttempts),
+	}
+}
+
+func seconds(d time.Duration) *int32 {
+	return iwfidl.PtrInt32(int32(d.Seconds()))
+}
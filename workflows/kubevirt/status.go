@@ -0,0 +1,97 @@
+package kubevirt
+
+import (
+	"time"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/persistence"
+	"github.com/go-logr/logr"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+// Data attributes kept up to date by reportStateStatus, so the API can describe a workflow without the history store
+const (
+	CurrentStateAttribute = "current_state"
+	StateStatusAttribute  = "state_status"
+	ErrorAttribute        = "error"
+	StartedAtAttribute    = "started_at"
+	UpdatedAtAttribute    = "updated_at"
+)
+
+func statusAttributeDefs() []iwf.PersistenceFieldDef {
+	return []iwf.PersistenceFieldDef{
+		iwf.DataAttributeDef(CurrentStateAttribute),
+		iwf.DataAttributeDef(StateStatusAttribute),
+		iwf.DataAttributeDef(ErrorAttribute),
+		iwf.DataAttributeDef(StartedAtAttribute),
+		iwf.DataAttributeDef(UpdatedAtAttribute),
+	}
+}
+
+// reportStateStatus records the status of a state in the status attributes and the history store. A state that
+// reports the status it already has without data, like clusterEntityState every time it waits for the next
+// command, adds nothing to the history.
+func reportStateStatus(ctx iwf.WorkflowContext, p iwf.Persistence, stateName string, status string, data map[string]interface{}) {
+	if len(data) == 0 {
+		var currentState, currentStatus string
+		p.GetDataAttribute(CurrentStateAttribute, &currentState)
+		p.GetDataAttribute(StateStatusAttribute, &currentStatus)
+		if currentState == stateName && currentStatus == status {
+			return
+		}
+	}
+	p.SetDataAttribute(CurrentStateAttribute, stateName)
+	p.SetDataAttribute(StateStatusAttribute, status)
+	p.SetDataAttribute(StartedAtAttribute, time.Unix(ctx.GetWorkflowStartTimestampSeconds(), 0).UTC())
+	p.SetDataAttribute(UpdatedAtAttribute, time.Now().UTC())
+	if msg, ok := data["error"]; ok {
+		p.SetDataAttribute(ErrorAttribute, msg)
+	}
+
+	workflowID := ctx.GetWorkflowId()
+	err := persistence.Save(ctx, workflowID, persistence.StateStatus{
+		WorkflowID: workflowID,
+		StateName:  stateName,
+		Status:     status,
+		Data:       data,
+	})
+	if err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "failed to save state status", "state", stateName)
+	}
+}
+
+// clearHistory drops the history and job logs an earlier run of the workflow ID left in the history store, so the
+// API shows only what the run that starts now does
+func clearHistory(ctx iwf.WorkflowContext) {
+	if err := persistence.Delete(ctx, ctx.GetWorkflowId()); err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "failed to clear the history of an earlier run")
+	}
+}
+
+// clearJobLogs drops the stored output of earlier capi-runner Jobs before a new one starts, its progress and log
+// tail are read from its own output only
+func clearJobLogs(ctx iwf.WorkflowContext) {
+	if err := persistence.DeleteLogs(ctx, ctx.GetWorkflowId()); err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "failed to clear the logs of an earlier job")
+	}
+}
+
+// failedJobLogTail is how many of the last capi-runner log lines are attached to a failed job check
+const failedJobLogTail = 10
+
+// jobLogTail returns the last log lines the newest pod of the workflow's capi-runner job wrote
+func jobLogTail(ctx iwf.WorkflowContext) []string {
+	lines, err := persistence.GetLogs(ctx, ctx.GetWorkflowId())
+	if err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "failed to read job logs")
+		return nil
+	}
+	lines = lastPodLines(lines)
+	if len(lines) > failedJobLogTail {
+		lines = lines[len(lines)-failedJobLogTail:]
+	}
+	tail := make([]string, 0, len(lines))
+	for _, l := range lines {
+		tail = append(tail, l.Message)
+	}
+	return tail
+}
@@ -0,0 +1,379 @@
+package kubevirt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
+	"github.com/go-logr/logr"
+	"github.com/indeedeng/iwf-golang-sdk/gen/iwfidl"
+	"github.com/indeedeng/iwf-golang-sdk/iwf"
+)
+
+// Signals to hold an upgrade and to continue it again
+const (
+	PauseUpgradeSignal  = "PauseUpgrade"
+	ResumeUpgradeSignal = "ResumeUpgrade"
+)
+
+// upgradeEndedChannel is published by the cluster workflow once an upgrade handed control back, it releases
+// pauseUpgradeState
+const upgradeEndedChannel = "upgradeEnded"
+
+// rolloutPausedAttribute is set while a check state of the upgrade holds the CAPI Cluster paused, so that no
+// further machines are rolled until ResumeUpgradeSignal
+const rolloutPausedAttribute = "rollout_paused"
+
+// upgradeCheck is the WaitUntil of the check states of the upgrade: a paused rollout waits for the resume signal,
+// a running one for the next check
+func upgradeCheck(p iwf.Persistence) *iwf.CommandRequest {
+	var rolloutPaused bool
+	p.GetDataAttribute(rolloutPausedAttribute, &rolloutPaused)
+	if rolloutPaused {
+		return iwf.AnyCommandCompletedRequest(iwf.NewSignalCommand("", ResumeUpgradeSignal))
+	}
+	return nextCheck(p, common.RetryInterval)
+}
+
+// holdRollout applies a pause request to the rollout a check state of the upgrade waits for, and resumes the
+// rollout once ResumeUpgradeSignal ended the wait. It returns true while the check state has to keep waiting.
+func holdRollout(
+	ctx iwf.WorkflowContext, p iwf.Persistence, svc service.ClusterUpgradeService, op common.KubeVirtUpgradeOperation,
+	stateName string,
+) (bool, error) {
+	var paused, rolloutPaused bool
+	p.GetDataAttribute("paused", &paused)
+	p.GetDataAttribute(rolloutPausedAttribute, &rolloutPaused)
+	switch {
+	case rolloutPaused:
+		if err := svc.PauseRollout(ctx, op, false); err != nil {
+			return false, err
+		}
+		p.SetDataAttribute(rolloutPausedAttribute, false)
+		p.SetDataAttribute("paused", false)
+		// the time spent paused does not count against the check
+		endCheck(p)
+		reportStateStatus(ctx, p, stateName, "resumed", nil)
+		return false, nil
+	case paused:
+		if err := svc.PauseRollout(ctx, op, true); err != nil {
+			return false, err
+		}
+		p.SetDataAttribute(rolloutPausedAttribute, true)
+		reportStateStatus(ctx, p, stateName, "paused", nil)
+		return true, nil
+	}
+	return false, nil
+}
+
+type validateUpgradeState struct {
+	iwf.WorkflowStateDefaultsNoWaitUntil
+	svc service.ClusterUpgradeService
+}
+
+func (i validateUpgradeState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &clusterEntityState{})
+}
+
+func (i validateUpgradeState) Execute(
+	ctx iwf.WorkflowContext,
+	input iwf.Object,
+	commandResults iwf.CommandResults,
+	persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	var operation common.KubeVirtUpgradeOperation
+	input.Get(&operation)
+	target := operation.UpgradeConfig.KubernetesVersion
+
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info(fmt.Sprintf("Validating upgrade of cluster %s to %s", operation.UpgradeConfig.ClusterName, target))
+
+	current, err := i.svc.ValidateUpgrade(ctx, operation)
+	if err != nil {
+		reportStateStatus(ctx, persistence, "validateUpgradeState", "failed", map[string]interface{}{"error": err.Error()})
+		return backToEntity(), nil
+	}
+	persistence.SetDataAttribute("current_version", current)
+	reportStateStatus(ctx, persistence, "validateUpgradeState", "success", map[string]interface{}{"from": current, "to": target})
+	// clusterEntityState releases the pause thread when the upgrade is over
+	persistence.SetDataAttribute("upgrading", true)
+	return iwf.MultiNextStatesWithInput(
+		iwf.NewStateMovement(&upgradeControlPlaneState{svc: i.svc}, input),
+		iwf.NewStateMovement(&pauseUpgradeState{}, nil),
+	), nil
+}
+
+// pauseUpgradeState runs next to the upgrade steps and records pause requests, the running check state or the next
+// upgradeCheckpointState applies them. It ends once upgradeEndedChannel is published.
+type pauseUpgradeState struct {
+	iwf.WorkflowStateDefaults
+}
+
+func (i pauseUpgradeState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, nil)
+}
+
+func (s pauseUpgradeState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	return iwf.AnyCommandCompletedRequest(
+		iwf.NewSignalCommand("", PauseUpgradeSignal),
+		iwf.NewInternalChannelCommand("", upgradeEndedChannel),
+	), nil
+}
+
+func (s pauseUpgradeState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	result := commandResults.GetSignalCommandResultByChannel(PauseUpgradeSignal)
+	if result == nil || result.Status != iwfidl.RECEIVED {
+		return iwf.DeadEnd, nil
+	}
+	persistence.SetDataAttribute("paused", true)
+	reportStateStatus(ctx, persistence, "pauseUpgradeState", "paused", nil)
+	return iwf.SingleNextState(&pauseUpgradeState{}, nil), nil
+}
+
+type upgradeControlPlaneState struct {
+	iwf.WorkflowStateDefaultsNoWaitUntil
+	svc service.ClusterUpgradeService
+}
+
+func (i upgradeControlPlaneState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &clusterEntityState{})
+}
+
+func (i upgradeControlPlaneState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info("Upgrading Control Plane")
+
+	var operation common.KubeVirtUpgradeOperation
+	input.Get(&operation)
+	if err := i.svc.UpgradeControlPlane(ctx, operation); err != nil {
+		reportStateStatus(ctx, persistence, "upgradeControlPlaneState", "failed", map[string]interface{}{"error": err.Error()})
+		return backToEntity(), nil
+	}
+	reportStateStatus(ctx, persistence, "upgradeControlPlaneState", "success", map[string]interface{}{"version": operation.UpgradeConfig.KubernetesVersion})
+	return iwf.SingleNextState(&waitForControlPlaneUpgradeState{svc: i.svc}, input), nil
+}
+
+// waitForControlPlaneUpgradeState checks once per execution whether the control plane finished its rollout
+type waitForControlPlaneUpgradeState struct {
+	iwf.WorkflowStateDefaults
+	svc service.ClusterUpgradeService
+}
+
+func (i waitForControlPlaneUpgradeState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &upgradeFailedState{})
+}
+
+func (i waitForControlPlaneUpgradeState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	return upgradeCheck(persistence), nil
+}
+
+func (i waitForControlPlaneUpgradeState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+	logger.Info("Checking Control Plane Upgrade")
+
+	var operation common.KubeVirtUpgradeOperation
+	input.Get(&operation)
+	held, err := holdRollout(ctx, persistence, i.svc, operation, "waitForControlPlaneUpgradeState")
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		return iwf.SingleNextState(&waitForControlPlaneUpgradeState{svc: i.svc}, input), nil
+	}
+
+	deadline := checkDeadline(persistence, common.RetryTimeout)
+	done, err := i.svc.CheckControlPlaneUpgraded(ctx, operation)
+	if err != nil {
+		// the hub could not be reached, the iWF server retries the check
+		return nil, err
+	}
+	if !done {
+		if time.Now().Before(deadline) {
+			return iwf.SingleNextState(&waitForControlPlaneUpgradeState{svc: i.svc}, input), nil
+		}
+		endCheck(persistence)
+		err = fmt.Errorf("control plane was not upgraded within %s", common.RetryTimeout)
+		logger.Error(err, "control plane did not become healthy")
+		reportStateStatus(ctx, persistence, "waitForControlPlaneUpgradeState", "failed", map[string]interface{}{"error": err.Error()})
+		return backToEntity(), nil
+	}
+	endCheck(persistence)
+	reportStateStatus(ctx, persistence, "waitForControlPlaneUpgradeState", "success", map[string]interface{}{"version": operation.UpgradeConfig.KubernetesVersion})
+	return iwf.SingleNextState(&upgradeCheckpointState{svc: i.svc}, input), nil
+}
+
+// upgradeCheckpointState sits between two upgrade steps, it holds the upgrade while paused and picks the next worker pool
+type upgradeCheckpointState struct {
+	iwf.WorkflowStateDefaults
+	svc service.ClusterUpgradeService
+}
+
+func (i upgradeCheckpointState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &clusterEntityState{})
+}
+
+func (i upgradeCheckpointState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	var paused bool
+	persistence.GetDataAttribute("paused", &paused)
+	if paused {
+		return iwf.AnyCommandCompletedRequest(iwf.NewSignalCommand("", ResumeUpgradeSignal)), nil
+	}
+	return iwf.EmptyCommandRequest(), nil
+}
+
+func (i upgradeCheckpointState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	if commandResults.GetSignalCommandResultByChannel(ResumeUpgradeSignal) != nil {
+		persistence.SetDataAttribute("paused", false)
+		reportStateStatus(ctx, persistence, "upgradeCheckpointState", "resumed", nil)
+	}
+
+	var operation common.KubeVirtUpgradeOperation
+	input.Get(&operation)
+	name, err := i.svc.NextMachineDeploymentToUpgrade(ctx, operation)
+	if err != nil {
+		reportStateStatus(ctx, persistence, "upgradeCheckpointState", "failed", map[string]interface{}{"error": err.Error()})
+		return backToEntity(), nil
+	}
+	if name == "" {
+		reportStateStatus(ctx, persistence, "upgradeCheckpointState", "success", map[string]interface{}{"version": operation.UpgradeConfig.KubernetesVersion})
+		return backToEntity(), nil
+	}
+	persistence.SetDataAttribute("machine_deployment", name)
+	return iwf.SingleNextState(&upgradeWorkerPoolState{svc: i.svc}, input), nil
+}
+
+type upgradeWorkerPoolState struct {
+	iwf.WorkflowStateDefaultsNoWaitUntil
+	svc service.ClusterUpgradeService
+}
+
+func (i upgradeWorkerPoolState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &clusterEntityState{})
+}
+
+func (i upgradeWorkerPoolState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	var name string
+	persistence.GetDataAttribute("machine_deployment", &name)
+	logger.Info(fmt.Sprintf("Upgrading MachineDeployment: (%s)", name))
+
+	var operation common.KubeVirtUpgradeOperation
+	input.Get(&operation)
+	if err := i.svc.UpgradeMachineDeployment(ctx, operation, name); err != nil {
+		reportStateStatus(ctx, persistence, "upgradeWorkerPoolState", "failed", map[string]interface{}{"error": err.Error(), "machineDeployment": name})
+		return backToEntity(), nil
+	}
+	reportStateStatus(ctx, persistence, "upgradeWorkerPoolState", "success", map[string]interface{}{"machineDeployment": name})
+	return iwf.SingleNextState(&waitForWorkerPoolUpgradeState{svc: i.svc}, input), nil
+}
+
+// waitForWorkerPoolUpgradeState checks once per execution whether the machines of the worker pool finished their
+// rollout
+type waitForWorkerPoolUpgradeState struct {
+	iwf.WorkflowStateDefaults
+	svc service.ClusterUpgradeService
+}
+
+func (i waitForWorkerPoolUpgradeState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &upgradeFailedState{})
+}
+
+func (i waitForWorkerPoolUpgradeState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	return upgradeCheck(persistence), nil
+}
+
+func (i waitForWorkerPoolUpgradeState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	var name string
+	persistence.GetDataAttribute("machine_deployment", &name)
+	logger.Info(fmt.Sprintf("Checking MachineDeployment Upgrade: (%s)", name))
+
+	var operation common.KubeVirtUpgradeOperation
+	input.Get(&operation)
+	held, err := holdRollout(ctx, persistence, i.svc, operation, "waitForWorkerPoolUpgradeState")
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		return iwf.SingleNextState(&waitForWorkerPoolUpgradeState{svc: i.svc}, input), nil
+	}
+
+	deadline := checkDeadline(persistence, common.RetryTimeout)
+	ready, err := i.svc.CheckMachineDeploymentReady(ctx, operation, name)
+	if err != nil {
+		// the hub could not be reached, the iWF server retries the check
+		return nil, err
+	}
+	if !ready {
+		if time.Now().Before(deadline) {
+			return iwf.SingleNextState(&waitForWorkerPoolUpgradeState{svc: i.svc}, input), nil
+		}
+		endCheck(persistence)
+		err = fmt.Errorf("machines were not ready within %s", common.RetryTimeout)
+		logger.Error(err, "machines did not become ready")
+		reportStateStatus(ctx, persistence, "waitForWorkerPoolUpgradeState", "failed", map[string]interface{}{"error": err.Error(), "machineDeployment": name})
+		return backToEntity(), nil
+	}
+	endCheck(persistence)
+	reportStateStatus(ctx, persistence, "waitForWorkerPoolUpgradeState", "success", map[string]interface{}{"machineDeployment": name})
+	return iwf.SingleNextState(&upgradeCheckpointState{svc: i.svc}, input), nil
+}
+
+// upgradeFailedState ends an upgrade whose check state failed after its last retry. A rollout that check state
+// paused is resumed, CAPI would leave the cluster alone otherwise.
+type upgradeFailedState struct {
+	iwf.WorkflowStateDefaultsNoWaitUntil
+	svc service.ClusterUpgradeService
+}
+
+func (i upgradeFailedState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &clusterEntityState{})
+}
+
+func (i upgradeFailedState) Execute(
+	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
+	communication iwf.Communication,
+) (*iwf.StateDecision, error) {
+	var rolloutPaused bool
+	persistence.GetDataAttribute(rolloutPausedAttribute, &rolloutPaused)
+	if rolloutPaused {
+		var operation common.KubeVirtUpgradeOperation
+		input.Get(&operation)
+		if err := i.svc.PauseRollout(ctx, operation, false); err != nil {
+			return nil, err
+		}
+		persistence.SetDataAttribute(rolloutPausedAttribute, false)
+	}
+	reportStateStatus(ctx, persistence, "upgradeFailedState", "failed", map[string]interface{}{"error": "the upgrade failed after its last retry"})
+	return backToEntity(), nil
+}
@@ -1,32 +1,82 @@
 package kubevirt
 
 import (
+	"errors"
 	"fmt"
-	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/persistence"
 	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
 	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
 	"github.com/go-logr/logr"
+	"github.com/indeedeng/iwf-golang-sdk/gen/iwfidl"
 	"github.com/indeedeng/iwf-golang-sdk/iwf"
-	"k8s.io/apimachinery/pkg/util/rand"
 	"time"
 )
 
-func NewKubevirtWorkflow(svc service.ClusterCreateService) iwf.ObjectWorkflow {
+func NewKubevirtWorkflow(
+	svc service.ClusterCreateService,
+	deleteSvc service.ClusterDeleteService,
+	scaleSvc service.ClusterScaleService,
+	upgradeSvc service.ClusterUpgradeService,
+) iwf.ObjectWorkflow {
 	return &KubevirtWorkflow{
-		svc: svc,
+		svc:        svc,
+		deleteSvc:  deleteSvc,
+		scaleSvc:   scaleSvc,
+		upgradeSvc: upgradeSvc,
 	}
 }
 
+// IdempotencyKeySearchAttribute holds the Idempotency-Key of the request that started a cluster workflow. It is
+// set when the workflow starts, the keyword search attribute must be registered on the iWF server's backend.
+const IdempotencyKeySearchAttribute = "IdempotencyKey"
+
+// ReadyAttribute is set once the provisioned cluster's credentials are synced and its entity workflow takes over
+const ReadyAttribute = "ready"
+
+// KubevirtWorkflow provisions a cluster and then stays open as the cluster's entity. It is the only entry point
+// for day-2 operations: they are sent as signals to the same workflow ID and run as states of this workflow.
 type KubevirtWorkflow struct {
 	iwf.WorkflowDefaults
-	svc service.ClusterCreateService
+	svc        service.ClusterCreateService
+	deleteSvc  service.ClusterDeleteService
+	scaleSvc   service.ClusterScaleService
+	upgradeSvc service.ClusterUpgradeService
 }
 
 func (w KubevirtWorkflow) GetPersistenceSchema() []iwf.PersistenceFieldDef {
-	return []iwf.PersistenceFieldDef{
+	return append([]iwf.PersistenceFieldDef{
 		iwf.DataAttributeDef("nsname"),
+		iwf.DataAttributeDef(deleteNamespaceAttribute),
+		iwf.DataAttributeDef(deleteResultAttribute),
+		iwf.DataAttributeDef(checkDeadlineAttribute),
+		iwf.DataAttributeDef(ProvisionStateAttribute),
+		iwf.DataAttributeDef(CompensationsAttribute),
 		iwf.DataAttributeDef("cleanup_reason"),
+		iwf.DataAttributeDef(cancelRequestedAttribute),
+		iwf.DataAttributeDef(ReadyAttribute),
+		iwf.DataAttributeDef("cluster"),
+		iwf.DataAttributeDef("current_version"),
+		iwf.DataAttributeDef("machine_deployment"),
+		iwf.DataAttributeDef("paused"),
+		iwf.DataAttributeDef(rolloutPausedAttribute),
+		iwf.DataAttributeDef("upgrading"),
+		iwf.DataAttributeDef(ProgressAttribute),
+		iwf.SearchAttributeDef(IdempotencyKeySearchAttribute, iwfidl.KEYWORD),
+	}, statusAttributeDefs()...)
+}
+
+func (w KubevirtWorkflow) GetCommunicationSchema() []iwf.CommunicationMethodDef {
+	var defs []iwf.CommunicationMethodDef
+	for _, signal := range clusterCommandSignals() {
+		defs = append(defs, iwf.SignalChannelDef(signal))
 	}
+	return append(defs,
+		iwf.SignalChannelDef(PauseUpgradeSignal),
+		iwf.SignalChannelDef(ResumeUpgradeSignal),
+		iwf.SignalChannelDef(CancelProvisionSignal),
+		iwf.InternalChannelDef(provisionedChannel),
+		iwf.InternalChannelDef(provisionStoppedChannel),
+		iwf.InternalChannelDef(upgradeEndedChannel),
+	)
 }
 
 func (e KubevirtWorkflow) GetWorkflowStates() []iwf.StateDef {
@@ -36,25 +86,57 @@ func (e KubevirtWorkflow) GetWorkflowStates() []iwf.StateDef {
 		iwf.NonStartingStateDef(&clusterOperationSuccessfulCheckState{svc: e.svc}),
 		iwf.NonStartingStateDef(&syncCredentialState{svc: e.svc}),
 		iwf.NonStartingStateDef(&cleanupNamespaceState{svc: e.svc}),
-		iwf.NonStartingStateDef(&waitForeverState{}),
+		iwf.NonStartingStateDef(&provisionFailedState{svc: e.svc}),
+		iwf.NonStartingStateDef(&compensateProvisionState{svc: e.svc}),
+		iwf.NonStartingStateDef(&cancelProvisionState{svc: e.svc}),
+		iwf.NonStartingStateDef(&stopProvisionState{svc: e.svc}),
+		iwf.NonStartingStateDef(&clusterEntityState{svc: e.svc}),
+		iwf.NonStartingStateDef(&rotateKubeconfigState{svc: e.svc}),
+		iwf.NonStartingStateDef(&scaleMachineDeploymentState{svc: e.scaleSvc}),
+		iwf.NonStartingStateDef(&waitForMachinesReadyState{svc: e.scaleSvc}),
+		iwf.NonStartingStateDef(&validateUpgradeState{svc: e.upgradeSvc}),
+		iwf.NonStartingStateDef(&pauseUpgradeState{}),
+		iwf.NonStartingStateDef(&upgradeControlPlaneState{svc: e.upgradeSvc}),
+		iwf.NonStartingStateDef(&waitForControlPlaneUpgradeState{svc: e.upgradeSvc}),
+		iwf.NonStartingStateDef(&upgradeCheckpointState{svc: e.upgradeSvc}),
+		iwf.NonStartingStateDef(&upgradeWorkerPoolState{svc: e.upgradeSvc}),
+		iwf.NonStartingStateDef(&waitForWorkerPoolUpgradeState{svc: e.upgradeSvc}),
+		iwf.NonStartingStateDef(&upgradeFailedState{svc: e.upgradeSvc}),
+		iwf.NonStartingStateDef(&createDeleteNamespaceState{svc: e.deleteSvc}),
+		iwf.NonStartingStateDef(&createDeleteJobState{svc: e.deleteSvc}),
+		iwf.NonStartingStateDef(&clusterDeletionCheckState{svc: e.deleteSvc}),
+		iwf.NonStartingStateDef(&waitForClusterDeletionState{svc: e.deleteSvc}),
+		iwf.NonStartingStateDef(&cleanupDeleteNamespaceState{svc: e.deleteSvc}),
+		iwf.NonStartingStateDef(&deleteFailedState{svc: e.deleteSvc}),
 	}
 }
 
-func reportStateStatus(ctx iwf.WorkflowContext, stateName string, status string, data map[string]interface{}) {
-	workflowID := ctx.GetWorkflowId()
-	persistence.Save(workflowID, persistence.StateStatus{
-		WorkflowID: workflowID,
-		StateName:  stateName,
-		Status:     status,
-		Data:       data,
-	})
-}
-
 type createNamespaceState struct {
-	iwf.WorkflowStateDefaultsNoWaitUntil
+	iwf.WorkflowStateDefaults
 	svc service.ClusterCreateService
 }
 
+func (i createNamespaceState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &provisionFailedState{svc: i.svc})
+}
+
+// WaitUntil picks the name of the runner namespace. Unlike the attributes set by a failed Execute it is persisted
+// right away, so every attempt of Execute creates the same namespace. Without a name the run starts from scratch,
+// a new run of a deleted cluster's workflow ID or a reset to the beginning, and the earlier history is dropped.
+func (i createNamespaceState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	var nsname string
+	persistence.GetDataAttribute("nsname", &nsname)
+	if nsname == "" {
+		clearHistory(ctx)
+		var operation common.KubeVirtCreateOperation
+		input.Get(&operation)
+		persistence.SetDataAttribute("nsname", common.RunnerNamespaceName(operation.CAPIConfig.ClusterName))
+	}
+	return iwf.EmptyCommandRequest(), nil
+}
+
 func (i createNamespaceState) Execute(
 	ctx iwf.WorkflowContext,
 	input iwf.Object,
@@ -62,20 +144,23 @@ func (i createNamespaceState) Execute(
 	persistence iwf.Persistence,
 	communication iwf.Communication,
 ) (*iwf.StateDecision, error) {
-	var operation common.KubeVirtCreateOperation
-	input.Get(&operation)
-	nsname := fmt.Sprintf("%s-%s", operation.CAPIConfig.ClusterName, rand.String(6))
+	var nsname string
+	persistence.GetDataAttribute("nsname", &nsname)
 
 	logger := logr.FromContextOrDiscard(ctx)
 	logger.Info(fmt.Sprintf("Creating Namespace: (%s)", nsname))
 
 	if err := i.svc.CreateNamespace(ctx, nsname); err != nil {
-		reportStateStatus(ctx, "createNamespaceState", "failed", map[string]interface{}{"error": err.Error()})
+		reportStateStatus(ctx, persistence, "createNamespaceState", "failed", map[string]interface{}{"error": err.Error()})
 		return nil, err
 	}
-	persistence.SetDataAttribute("nsname", nsname)
-	reportStateStatus(ctx, "createNamespaceState", "success", map[string]interface{}{"nsname": nsname})
-	return iwf.SingleNextState(&createJobState{svc: i.svc}, input), nil
+	registerCompensations(persistence, compensateNamespace)
+	persistence.SetDataAttribute(ProvisionStateAttribute, stateID(createJobState{}))
+	reportStateStatus(ctx, persistence, "createNamespaceState", "success", map[string]interface{}{"nsname": nsname})
+	return iwf.MultiNextStatesWithInput(
+		iwf.NewStateMovement(&createJobState{svc: i.svc}, input),
+		iwf.NewStateMovement(&cancelProvisionState{svc: i.svc}, input),
+	), nil
 }
 
 type createJobState struct {
@@ -83,10 +168,17 @@ type createJobState struct {
 	svc service.ClusterCreateService
 }
 
+func (i createJobState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &provisionFailedState{svc: i.svc})
+}
+
 func (i createJobState) Execute(
 	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
 	communication iwf.Communication,
 ) (*iwf.StateDecision, error) {
+	if stopForCancel(persistence, communication) {
+		return iwf.DeadEnd, nil
+	}
 	logger := logr.FromContextOrDiscard(ctx)
 	logger.Info("Creating Job To Run Cluster Creation Script")
 
@@ -96,41 +188,80 @@ func (i createJobState) Execute(
 	var operation common.KubeVirtCreateOperation
 	input.Get(&operation)
 	if err := i.svc.CreateJob(ctx, operation, nsname); err != nil {
-		reportStateStatus(ctx, "createJobState", "failed", map[string]interface{}{"error": err.Error()})
+		reportStateStatus(ctx, persistence, "createJobState", "failed", map[string]interface{}{"error": err.Error()})
+		if errors.Is(err, common.ErrNoRunnerImage) {
+			// retrying cannot help until the worker is configured with an image
+			return compensateProvision(persistence, i.svc, input), nil
+		}
 		return nil, err
 	}
-	reportStateStatus(ctx, "createJobState", "success", map[string]interface{}{"nsname": nsname})
+	// the script applies the CAPI Cluster once the Job runs
+	registerCompensations(persistence, compensateScriptSecret, compensateJob, compensateCAPICluster)
+	persistence.SetDataAttribute(ProvisionStateAttribute, stateID(clusterOperationSuccessfulCheckState{}))
+	reportStateStatus(ctx, persistence, "createJobState", "success", map[string]interface{}{"nsname": nsname})
 	return iwf.SingleNextState(&clusterOperationSuccessfulCheckState{svc: i.svc}, input), nil
 }
 
+// clusterOperationSuccessfulCheckState checks the capi-runner Job once per execution, it is a check state like
+// described at checkDeadlineAttribute.
 type clusterOperationSuccessfulCheckState struct {
-	iwf.WorkflowStateDefaultsNoWaitUntil
+	iwf.WorkflowStateDefaults
 	svc service.ClusterCreateService
 }
 
+func (i clusterOperationSuccessfulCheckState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &provisionFailedState{svc: i.svc})
+}
+
+func (i clusterOperationSuccessfulCheckState) WaitUntil(
+	ctx iwf.WorkflowContext, input iwf.Object, persistence iwf.Persistence, communication iwf.Communication,
+) (*iwf.CommandRequest, error) {
+	return nextCheck(persistence, service.RetryInterval), nil
+}
+
 func (i clusterOperationSuccessfulCheckState) Execute(
 	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
 	communication iwf.Communication,
 ) (*iwf.StateDecision, error) {
+	if stopForCancel(persistence, communication) {
+		return iwf.DeadEnd, nil
+	}
 	logger := logr.FromContextOrDiscard(ctx)
-	logger.Info("Waiting for Cluster Creation Job to be Successful")
+	logger.Info("Checking Cluster Creation Job")
 
 	var nsname string
 	persistence.GetDataAttribute("nsname", &nsname)
+	deadline := checkDeadline(persistence, service.RetryTimeout)
 
-	var operation common.KubeVirtCreateOperation
-	input.Get(&operation)
-
-	if err := i.svc.WaitForClusterOperationToBeCompleted(ctx, nsname); err != nil {
+	i.svc.StreamJobLogs(ctx.GetWorkflowId(), nsname)
+	done, err := i.svc.CheckClusterOperation(ctx, nsname)
+	if err != nil && !errors.Is(err, service.ErrJobFailed) {
+		// the Job could not be read, the iWF server retries the check
+		return nil, err
+	}
+	if done || err != nil {
+		// the last lines of a finished script are stored before its progress is read
+		i.svc.WaitForJobLogs(ctx.GetWorkflowId())
+	}
+	reportScriptProgress(ctx, persistence, "clusterOperationCheck")
+	if err == nil && !done && time.Now().After(deadline) {
+		err = fmt.Errorf("cluster creation job did not finish within %s", service.RetryTimeout)
+	}
+	if err != nil {
 		logger.Error(err, "failed to create cluster")
-		persistence.SetDataAttribute("cleanup_reason", "failed")
-		reportStateStatus(ctx, "clusterOperationCheck", "failed", map[string]interface{}{"error": err.Error()})
-		return iwf.SingleNextState(&cleanupNamespaceState{svc: i.svc}, input), nil
+		endCheck(persistence)
+		reportStateStatus(ctx, persistence, "clusterOperationCheck", "failed", map[string]interface{}{"error": err.Error(), "logs": jobLogTail(ctx)})
+		return compensateProvision(persistence, i.svc, input), nil
+	}
+	if !done {
+		return iwf.SingleNextState(&clusterOperationSuccessfulCheckState{svc: i.svc}, input), nil
 	}
 
 	logger.Info("Successfully Created Cluster")
+	endCheck(persistence)
 	persistence.SetDataAttribute("cleanup_reason", "success")
-	reportStateStatus(ctx, "clusterOperationCheck", "success", map[string]interface{}{"nsname": nsname})
+	persistence.SetDataAttribute(ProvisionStateAttribute, stateID(syncCredentialState{}))
+	reportStateStatus(ctx, persistence, "clusterOperationCheck", "success", map[string]interface{}{"nsname": nsname})
 	return iwf.SingleNextState(&syncCredentialState{svc: i.svc}, input), nil
 }
 
@@ -139,10 +270,17 @@ type syncCredentialState struct {
 	svc service.ClusterCreateService
 }
 
+func (i syncCredentialState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &provisionFailedState{svc: i.svc})
+}
+
 func (i syncCredentialState) Execute(
 	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
 	communication iwf.Communication,
 ) (*iwf.StateDecision, error) {
+	if stopForCancel(persistence, communication) {
+		return iwf.DeadEnd, nil
+	}
 	var nsname string
 	persistence.GetDataAttribute("nsname", &nsname)
 
@@ -150,10 +288,11 @@ func (i syncCredentialState) Execute(
 	input.Get(&operation)
 	kubeconfig := operation.KubeVirtCredential.KubeConfig
 	if err := i.svc.SyncCredential(ctx, kubeconfig, operation, nsname); err != nil {
-		reportStateStatus(ctx, "syncCredentialState", "failed", map[string]interface{}{"error": err.Error()})
+		reportStateStatus(ctx, persistence, "syncCredentialState", "failed", map[string]interface{}{"error": err.Error()})
 		return nil, fmt.Errorf("failed to sync credential: %v", err)
 	}
-	reportStateStatus(ctx, "syncCredentialState", "success", map[string]interface{}{"nsname": nsname})
+	persistence.SetDataAttribute(ProvisionStateAttribute, stateID(cleanupNamespaceState{}))
+	reportStateStatus(ctx, persistence, "syncCredentialState", "success", map[string]interface{}{"nsname": nsname})
 	return iwf.SingleNextState(&cleanupNamespaceState{svc: i.svc}, input), nil
 }
 
@@ -162,10 +301,17 @@ type cleanupNamespaceState struct {
 	svc service.ClusterCreateService
 }
 
+func (i cleanupNamespaceState) GetStateOptions() *iwf.StateOptions {
+	return stateOptions(i, &provisionFailedState{svc: i.svc})
+}
+
 func (i cleanupNamespaceState) Execute(
 	ctx iwf.WorkflowContext, input iwf.Object, commandResults iwf.CommandResults, persistence iwf.Persistence,
 	communication iwf.Communication,
 ) (*iwf.StateDecision, error) {
+	if stopForCancel(persistence, communication) {
+		return iwf.DeadEnd, nil
+	}
 	logger := logr.FromContextOrDiscard(ctx)
 
 	var nsname string
@@ -175,33 +321,19 @@ func (i cleanupNamespaceState) Execute(
 
 	if err := i.svc.CleanupNamespace(ctx, nsname); err != nil {
 		logger.Error(err, "failed to cleanup namespace")
-		reportStateStatus(ctx, "cleanupNamespaceState", "failed", map[string]interface{}{"error": err.Error()})
+		reportStateStatus(ctx, persistence, "cleanupNamespaceState", "failed", map[string]interface{}{"error": err.Error()})
 		return nil, err
 	}
-	reportStateStatus(ctx, "cleanupNamespaceState", reason, map[string]interface{}{"nsname": nsname})
-	if reason == "failed" {
-		return iwf.ForceFailWorkflow("Cluster creation failed, namespace cleaned up."), nil
-	}
-	return iwf.SingleNextState(&waitForeverState{}, input), nil
-}
-
-type waitForeverState struct {
-	iwf.WorkflowStateDefaultsNoWaitUntil
-}
-
-func (s waitForeverState) Execute(
-	ctx iwf.WorkflowContext,
-	input iwf.Object,
-	commandResults iwf.CommandResults,
-	persistence iwf.Persistence,
-	communication iwf.Communication,
-) (*iwf.StateDecision, error) {
-	reportStateStatus(ctx, "waitForeverState", "running", nil)
-	for {
-		time.Sleep(24 * time.Hour)
-	}
-	return iwf.GracefulCompletingWorkflow, nil
+	reportStateStatus(ctx, persistence, "cleanupNamespaceState", reason, map[string]interface{}{"nsname": nsname})
+	// the cluster is provisioned, from here on it is deleted by the delete command
+	persistence.SetDataAttribute(CompensationsAttribute, []string{})
+	var operation common.KubeVirtCreateOperation
+	input.Get(&operation)
+	persistence.SetDataAttribute("cluster", operation)
+	persistence.SetDataAttribute(ReadyAttribute, true)
+	// the error of a failed attempt that was retried no longer applies
+	persistence.SetDataAttribute(ErrorAttribute, "")
+	// the cluster can no longer be cancelled, only deleted
+	communication.PublishInternalChannel(provisionedChannel, nil)
+	return iwf.SingleNextState(&clusterEntityState{svc: i.svc}, nil), nil
 }
-
-// input object dibo.
-// sleep dibo. completion hobena.
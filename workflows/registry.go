@@ -1,34 +1,60 @@
 package workflows
 
 import (
+	"fmt"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/credential"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
 	cluster "github.com/RejwankabirHamim/cadence-iwf-poc/workflows/kubevirt"
 	"github.com/RejwankabirHamim/cadence-iwf-poc/workflows/service"
 	"github.com/indeedeng/iwf-golang-sdk/iwf"
+	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
-var registry = iwf.NewRegistry()
+// Options are the dependencies of the workflow services. The zero value is enough when the registry only
+// backs an iwf.Client, which needs the workflow definitions but never executes states.
+type Options struct {
+	// K8sClient runs the capi-runner jobs and JobLogs copies their logs
+	K8sClient    client.Client
+	JobLogs      *service.LogTailer
+	RunnerImages common.RunnerImages
+	// Credentials keeps the kubeconfigs of the provisioned clusters
+	Credentials credential.Store
+}
+
+// NewRegistry registers the workflows with services built from opts
+func NewRegistry(opts Options) (iwf.Registry, error) {
+	svc := service.NewClusterCreateService(opts.K8sClient, opts.JobLogs, opts.RunnerImages, opts.Credentials)
+	deleteSvc := service.NewClusterDeleteService(opts.K8sClient, opts.JobLogs, opts.RunnerImages, opts.Credentials)
+	scaleSvc := service.NewClusterScaleService()
+	upgradeSvc := service.NewClusterUpgradeService()
+
+	registry := iwf.NewRegistry()
+	err := registry.AddWorkflows(
+		cluster.NewKubevirtWorkflow(svc, deleteSvc, scaleSvc, upgradeSvc),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
 
-func init() {
-	cfg, err := config.GetConfig() // uses $HOME/.kube/config by default; set KUBECONFIG env for custom path
+// NewK8sClients returns the clients for the cluster the capi-runner jobs run on. It uses $HOME/.kube/config
+// by default, set the KUBECONFIG env for a custom path.
+func NewK8sClients() (client.Client, kubernetes.Interface, error) {
+	cfg, err := config.GetConfig()
 	if err != nil {
-		panic("failed to get kubeconfig: " + err.Error())
+		return nil, nil, fmt.Errorf("failed to get kubeconfig: %w", err)
 	}
 	k8sClient, err := client.New(cfg, client.Options{})
 	if err != nil {
-		panic("failed to create k8s client: " + err.Error())
+		return nil, nil, fmt.Errorf("failed to create k8s client: %w", err)
 	}
-	svc := service.NewClusterCreateService(k8sClient)
-
-	err = registry.AddWorkflows(
-		cluster.NewKubevirtWorkflow(svc),
-	)
+	clientset, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("failed to create k8s clientset: %w", err)
 	}
-}
-
-func GetRegistry() iwf.Registry {
-	return registry
+	return k8sClient, clientset, nil
 }
@@ -2,7 +2,6 @@ package service
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
@@ -14,6 +13,7 @@ import (
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/credential"
 	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
 	"github.com/pkg/errors"
 )
@@ -24,16 +24,28 @@ const (
 	CAPIRunnerJobName = "capi-runner"
 )
 
+// ErrJobFailed is returned by CheckClusterOperation once the capi-runner Job failed
+var ErrJobFailed = errors.New("failed to perform cluster operation")
+
 type ClusterCreateService interface {
 	CreateNamespace(ctx context.Context, nsname string) error
 	CreateJob(ctx context.Context, op common.KubeVirtCreateOperation, namespace string) error
-	WaitForClusterOperationToBeCompleted(ctx context.Context, namespace string) error
+	CheckClusterOperation(ctx context.Context, namespace string) (bool, error)
+	StreamJobLogs(workflowID, namespace string)
+	WaitForJobLogs(workflowID string)
 	SyncCredential(ctx context.Context, kubeconfig string, op common.KubeVirtCreateOperation, nsname string) error
 	CleanupNamespace(ctx context.Context, namespace string) error
+	DeleteScriptSecret(ctx context.Context, namespace string) error
+	DeleteJob(ctx context.Context, namespace string) error
+	DeleteCAPICluster(ctx context.Context, kubeconfig string, op common.KubeVirtCreateOperation, nsname string) error
+	RotateKubeconfig(ctx context.Context, kubeconfig string, op common.KubeVirtCreateOperation, nsname string) error
 }
 
 type myServiceImpl struct {
-	k8sClient client.Client
+	*LogTailer
+	k8sClient   client.Client
+	images      common.RunnerImages
+	credentials credential.Store
 }
 
 func (m *myServiceImpl) CreateNamespace(ctx context.Context, nsname string) error {
@@ -42,28 +54,105 @@ func (m *myServiceImpl) CreateNamespace(ctx context.Context, nsname string) erro
 			Name: nsname,
 		},
 	}
-	return m.k8sClient.Create(ctx, ns, &client.CreateOptions{})
+	err := m.k8sClient.Create(ctx, ns, &client.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		// the state is being retried
+		return nil
+	}
+	return err
 }
 
 func (m *myServiceImpl) CreateJob(ctx context.Context, op common.KubeVirtCreateOperation, namespace string) error {
 	scriptSecretName := namespace
 
-	err := op.CreateScriptSecret(ctx, m.k8sClient, scriptSecretName)
+	imgName, err := op.GetBaseImage(m.images)
 	if err != nil {
 		return err
 	}
 
-	imgName, err := op.GetBaseImage(ctx, m.k8sClient)
+	err = op.CreateScriptSecret(ctx, m.k8sClient, scriptSecretName)
 	if err != nil {
 		return err
 	}
+	if err := m.copyPullSecrets(ctx, namespace); err != nil {
+		return err
+	}
 
-	job := &batchv1.Job{
+	replace, err := m.removeFailedJob(ctx, namespace)
+	if err != nil || !replace {
+		return err
+	}
+	job := newCAPIRunnerJob(namespace, op.CAPIConfig.ClusterName, scriptSecretName, imgName, m.images.PullSecrets)
+	return m.k8sClient.Create(ctx, job, &client.CreateOptions{})
+}
+
+// removeFailedJob makes room for a new capi-runner Job in namespace. A failed Job is deleted, a Job that is
+// running or succeeded is kept, so a retried state neither runs the script twice nor leaves the failed run behind.
+func (m *myServiceImpl) removeFailedJob(ctx context.Context, namespace string) (bool, error) {
+	key := types.NamespacedName{Namespace: namespace, Name: CAPIRunnerJobName}
+	job := &batchv1.Job{}
+	err := m.k8sClient.Get(ctx, key, job)
+	if k8serrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if job.Status.Failed == 0 {
+		return false, nil
+	}
+
+	if err := m.DeleteJob(ctx, namespace); err != nil {
+		return false, err
+	}
+	err = wait.PollUntilContextTimeout(ctx, time.Second, time.Minute, true, func(ctx context.Context) (bool, error) {
+		err := m.k8sClient.Get(ctx, key, &batchv1.Job{})
+		if k8serrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to replace failed capi-runner job")
+	}
+	return true, nil
+}
+
+// copyPullSecrets copies the configured image pull secrets into the namespace of a Job
+func (m *myServiceImpl) copyPullSecrets(ctx context.Context, namespace string) error {
+	for _, name := range m.images.PullSecrets {
+		src := &corev1.Secret{}
+		err := m.k8sClient.Get(ctx, types.NamespacedName{Namespace: m.images.PullSecretNamespace, Name: name}, src)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get image pull secret %s/%s", m.images.PullSecretNamespace, name)
+		}
+		dst := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Type: src.Type,
+			Data: src.Data,
+		}
+		if err := m.k8sClient.Create(ctx, dst); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return errors.Wrapf(err, "failed to copy image pull secret %s", name)
+		}
+	}
+	return nil
+}
+
+func newCAPIRunnerJob(namespace, clusterName, scriptSecretName, imgName string, pullSecrets []string) *batchv1.Job {
+	var imagePullSecrets []corev1.LocalObjectReference
+	for _, name := range pullSecrets {
+		imagePullSecrets = append(imagePullSecrets, corev1.LocalObjectReference{Name: name})
+	}
+
+	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "capi-runner",
+			Name:      CAPIRunnerJobName,
 			Namespace: namespace,
 			Labels: map[string]string{
-				"cluster-name": op.CAPIConfig.ClusterName,
+				"cluster-name": clusterName,
 			},
 		},
 		Spec: batchv1.JobSpec{
@@ -94,7 +183,8 @@ func (m *myServiceImpl) CreateJob(ctx context.Context, op common.KubeVirtCreateO
 							},
 						},
 					},
-					RestartPolicy: corev1.RestartPolicyNever,
+					RestartPolicy:    corev1.RestartPolicyNever,
+					ImagePullSecrets: imagePullSecrets,
 					Volumes: []corev1.Volume{
 						{
 							Name: "script",
@@ -117,32 +207,29 @@ func (m *myServiceImpl) CreateJob(ctx context.Context, op common.KubeVirtCreateO
 			BackoffLimit: ptr.To(int32(0)),
 		},
 	}
-
-	return m.k8sClient.Create(ctx, job, &client.CreateOptions{})
 }
 
-func (m *myServiceImpl) WaitForClusterOperationToBeCompleted(ctx context.Context, namespace string) error {
+// CheckClusterOperation reports whether the capi-runner Job in namespace has succeeded, a failed Job is an error
+func (m *myServiceImpl) CheckClusterOperation(ctx context.Context, namespace string) (bool, error) {
 	job := &batchv1.Job{}
-	return wait.PollUntilContextTimeout(ctx, RetryInterval, RetryTimeout, true, func(ctx context.Context) (bool, error) {
-		err := m.k8sClient.Get(ctx, types.NamespacedName{
-			Name:      CAPIRunnerJobName,
-			Namespace: namespace,
-		}, job)
-		if err != nil {
-			if !k8serrors.IsNotFound(err) {
-				return false, err
-			} else {
-				return false, nil
-			}
-		}
-		if job.Status.Succeeded > 0 {
-			return true, nil
-		}
-		if job.Status.Failed > 0 {
-			return false, fmt.Errorf("failed to perform cluster operation")
+	err := m.k8sClient.Get(ctx, types.NamespacedName{
+		Name:      CAPIRunnerJobName,
+		Namespace: namespace,
+	}, job)
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return false, err
+		} else {
+			return false, nil
 		}
-		return false, nil
-	})
+	}
+	if job.Status.Succeeded > 0 {
+		return true, nil
+	}
+	if job.Status.Failed > 0 {
+		return false, ErrJobFailed
+	}
+	return false, nil
 }
 
 func (m *myServiceImpl) SyncCredential(ctx context.Context, kubeconfig string, op common.KubeVirtCreateOperation, nsname string) error {
@@ -150,13 +237,41 @@ func (m *myServiceImpl) SyncCredential(ctx context.Context, kubeconfig string, o
 		Namespace: nsname,
 		Name:      op.CAPIConfig.ClusterName + "-kubeconfig",
 	}
-	var err error
-	op.ImportOption.Provider.KubeConfig, err = common.GetCAPIKubevirtKubeconfig(ctx, kubeconfig, kubeconfigSecretName)
+	clusterKubeconfig, err := common.GetCAPIKubevirtKubeconfig(ctx, kubeconfig, kubeconfigSecretName)
 	if err != nil {
 		return err
 	}
-	op.ImportOption.BasicInfo.InfraNamespace = nsname
-	return nil
+	return m.saveClusterKubeconfig(ctx, op, clusterKubeconfig)
+}
+
+func (m *myServiceImpl) RotateKubeconfig(ctx context.Context, kubeconfig string, op common.KubeVirtCreateOperation, nsname string) error {
+	kubeconfigSecretName := types.NamespacedName{
+		Namespace: nsname,
+		Name:      op.CAPIConfig.ClusterName + "-kubeconfig",
+	}
+	clusterKubeconfig, err := common.RotateCAPIKubeconfig(ctx, kubeconfig, kubeconfigSecretName)
+	if err != nil {
+		return err
+	}
+	return m.saveClusterKubeconfig(ctx, op, clusterKubeconfig)
+}
+
+// saveClusterKubeconfig stores the admin kubeconfig of the cluster as a credential of the cluster's owner
+func (m *myServiceImpl) saveClusterKubeconfig(ctx context.Context, op common.KubeVirtCreateOperation, clusterKubeconfig string) error {
+	if m.credentials == nil {
+		return errors.New("no credential store configured for cluster kubeconfigs")
+	}
+	ownerID, clusterName := op.ImportOption.BasicInfo.OwnerID, op.CAPIConfig.ClusterName
+	// never replace a credential of the same name that was not written for this cluster
+	existing, err := m.credentials.Get(ctx, ownerID, credential.ClusterCredentialName(clusterName))
+	switch {
+	case err == nil && !credential.IsClusterCredential(existing, clusterName):
+		return errors.Wrapf(credential.ErrReservedName, "credential %q is not the kubeconfig of cluster %s", existing.Spec.Name, clusterName)
+	case err != nil && !errors.Is(err, credential.ErrNotFound):
+		return errors.Wrap(err, "failed to look up cluster kubeconfig")
+	}
+	cred := credential.NewClusterCredential(ownerID, clusterName, clusterKubeconfig)
+	return errors.Wrap(m.credentials.Put(ctx, cred), "failed to store cluster kubeconfig")
 }
 
 func (m *myServiceImpl) CleanupNamespace(ctx context.Context, namespace string) error {
@@ -173,6 +288,51 @@ func (m *myServiceImpl) CleanupNamespace(ctx context.Context, namespace string)
 	return nil
 }
 
-func NewClusterCreateService(k8sClient client.Client) ClusterCreateService {
-	return &myServiceImpl{k8sClient: k8sClient}
+// DeleteScriptSecret deletes the Secret CreateJob stores the creation script of namespace in
+func (m *myServiceImpl) DeleteScriptSecret(ctx context.Context, namespace string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      namespace,
+			Namespace: namespace,
+		},
+	}
+	if err := m.k8sClient.Delete(ctx, secret); err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrap(err, "failed to delete script secret")
+	}
+	return nil
+}
+
+// DeleteJob deletes the capi-runner Job of namespace together with its pod
+func (m *myServiceImpl) DeleteJob(ctx context.Context, namespace string) error {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      CAPIRunnerJobName,
+			Namespace: namespace,
+		},
+	}
+	err := m.k8sClient.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrap(err, "failed to delete capi-runner job")
+	}
+	return nil
+}
+
+// DeleteCAPICluster deletes the CAPI Cluster the creation script may have applied to the cluster of kubeconfig
+func (m *myServiceImpl) DeleteCAPICluster(ctx context.Context, kubeconfig string, op common.KubeVirtCreateOperation, nsname string) error {
+	kc, err := common.GetHubClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+	return common.DeleteCAPICluster(ctx, kc, types.NamespacedName{Namespace: nsname, Name: op.CAPIConfig.ClusterName})
+}
+
+func NewClusterCreateService(
+	k8sClient client.Client, logs *LogTailer, images common.RunnerImages, credentials credential.Store,
+) ClusterCreateService {
+	return &myServiceImpl{
+		LogTailer:   logs,
+		k8sClient:   k8sClient,
+		images:      images,
+		credentials: credentials,
+	}
 }
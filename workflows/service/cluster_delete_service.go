@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/credential"
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/pkg/errors"
+)
+
+type ClusterDeleteService interface {
+	CreateNamespace(ctx context.Context, nsname string) error
+	CreateJob(ctx context.Context, op common.KubeVirtDeleteOperation, namespace string) error
+	CheckClusterOperation(ctx context.Context, namespace string) (bool, error)
+	StreamJobLogs(workflowID, namespace string)
+	WaitForJobLogs(workflowID string)
+	CheckClusterDeleted(ctx context.Context, op common.KubeVirtDeleteOperation) (bool, error)
+	CleanupNamespace(ctx context.Context, namespace string) error
+	DeleteClusterKubeconfig(ctx context.Context, op common.KubeVirtDeleteOperation) error
+}
+
+type deleteServiceImpl struct {
+	*myServiceImpl
+}
+
+func (m *deleteServiceImpl) CreateJob(ctx context.Context, op common.KubeVirtDeleteOperation, namespace string) error {
+	scriptSecretName := namespace
+
+	imgName, err := op.GetBaseImage(m.images)
+	if err != nil {
+		return err
+	}
+
+	err = op.CreateScriptSecret(ctx, m.k8sClient, scriptSecretName)
+	if err != nil {
+		return err
+	}
+	if err := m.copyPullSecrets(ctx, namespace); err != nil {
+		return err
+	}
+
+	replace, err := m.removeFailedJob(ctx, namespace)
+	if err != nil || !replace {
+		return err
+	}
+	job := newCAPIRunnerJob(namespace, op.DeleteConfig.ClusterName, scriptSecretName, imgName, m.images.PullSecrets)
+	return m.k8sClient.Create(ctx, job, &client.CreateOptions{})
+}
+
+// CheckClusterDeleted reports whether the CAPI Cluster and its infra namespace are gone from the hub
+func (m *deleteServiceImpl) CheckClusterDeleted(ctx context.Context, op common.KubeVirtDeleteOperation) (bool, error) {
+	return common.IsCAPIClusterDeleted(ctx, op.KubeVirtCredential.KubeConfig, types.NamespacedName{
+		Namespace: op.DeleteConfig.InfraNamespace,
+		Name:      op.DeleteConfig.ClusterName,
+	})
+}
+
+// DeleteClusterKubeconfig removes the credential saveClusterKubeconfig stored for the deleted cluster, a credential
+// of the same name that was not written for the cluster is left alone
+func (m *deleteServiceImpl) DeleteClusterKubeconfig(ctx context.Context, op common.KubeVirtDeleteOperation) error {
+	if m.credentials == nil {
+		return errors.New("no credential store configured for cluster kubeconfigs")
+	}
+	ownerID, clusterName := op.DeleteConfig.OwnerID, op.DeleteConfig.ClusterName
+	existing, err := m.credentials.Get(ctx, ownerID, credential.ClusterCredentialName(clusterName))
+	switch {
+	case errors.Is(err, credential.ErrNotFound):
+		return nil
+	case err != nil:
+		return errors.Wrap(err, "failed to look up cluster kubeconfig")
+	case !credential.IsClusterCredential(existing, clusterName):
+		return nil
+	}
+	return errors.Wrap(m.credentials.Delete(ctx, ownerID, existing.Spec.Name), "failed to delete cluster kubeconfig")
+}
+
+func NewClusterDeleteService(
+	k8sClient client.Client, logs *LogTailer, images common.RunnerImages, credentials credential.Store,
+) ClusterDeleteService {
+	return &deleteServiceImpl{myServiceImpl: &myServiceImpl{
+		LogTailer:   logs,
+		k8sClient:   k8sClient,
+		images:      images,
+		credentials: credentials,
+	}}
+}
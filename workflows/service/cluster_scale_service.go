@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+)
+
+type ClusterScaleService interface {
+	ScaleMachineDeployment(ctx context.Context, op common.KubeVirtScaleOperation) error
+	CheckMachinesReady(ctx context.Context, op common.KubeVirtScaleOperation) (bool, error)
+}
+
+type scaleServiceImpl struct{}
+
+func (m *scaleServiceImpl) ScaleMachineDeployment(ctx context.Context, op common.KubeVirtScaleOperation) error {
+	kc, err := common.GetHubClient(op.KubeVirtCredential.KubeConfig)
+	if err != nil {
+		return err
+	}
+	return common.ScaleMachineDeployment(ctx, kc, op.ScaleConfig)
+}
+
+// CheckMachinesReady reports whether the machines of the scaled pool finished their rollout
+func (m *scaleServiceImpl) CheckMachinesReady(ctx context.Context, op common.KubeVirtScaleOperation) (bool, error) {
+	kc, err := common.GetHubClient(op.KubeVirtCredential.KubeConfig)
+	if err != nil {
+		return false, err
+	}
+	key := types.NamespacedName{
+		Namespace: op.ScaleConfig.InfraNamespace,
+		Name:      op.ScaleConfig.MachineDeploymentName(),
+	}
+	ready, err := common.IsMachineDeploymentReady(ctx, kc, key)
+	if err != nil || !ready {
+		return false, err
+	}
+	// the rollout is done, the templates of the replaced machines are no longer needed
+	return true, common.DeleteUnusedMachineTemplates(ctx, kc, key)
+}
+
+func NewClusterScaleService() ClusterScaleService {
+	return &scaleServiceImpl{}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/pkg/errors"
+)
+
+type ClusterUpgradeService interface {
+	ValidateUpgrade(ctx context.Context, op common.KubeVirtUpgradeOperation) (string, error)
+	UpgradeControlPlane(ctx context.Context, op common.KubeVirtUpgradeOperation) error
+	CheckControlPlaneUpgraded(ctx context.Context, op common.KubeVirtUpgradeOperation) (bool, error)
+	NextMachineDeploymentToUpgrade(ctx context.Context, op common.KubeVirtUpgradeOperation) (string, error)
+	UpgradeMachineDeployment(ctx context.Context, op common.KubeVirtUpgradeOperation, name string) error
+	CheckMachineDeploymentReady(ctx context.Context, op common.KubeVirtUpgradeOperation, name string) (bool, error)
+	PauseRollout(ctx context.Context, op common.KubeVirtUpgradeOperation, paused bool) error
+}
+
+type upgradeServiceImpl struct{}
+
+func clusterKey(op common.KubeVirtUpgradeOperation) types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: op.UpgradeConfig.InfraNamespace,
+		Name:      op.UpgradeConfig.ClusterName,
+	}
+}
+
+func (m *upgradeServiceImpl) getControlPlane(ctx context.Context, op common.KubeVirtUpgradeOperation) (*unstructured.Unstructured, error) {
+	kc, err := common.GetHubClient(op.KubeVirtCredential.KubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return common.GetControlPlane(ctx, kc, clusterKey(op))
+}
+
+// ValidateUpgrade checks the target version against the version the control plane runs and returns the latter
+func (m *upgradeServiceImpl) ValidateUpgrade(ctx context.Context, op common.KubeVirtUpgradeOperation) (string, error) {
+	cp, err := m.getControlPlane(ctx, op)
+	if err != nil {
+		return "", err
+	}
+	current, found, err := unstructured.NestedString(cp.Object, "spec", "version")
+	if err != nil || !found {
+		return "", errors.Errorf("control plane %s has no version", cp.GetName())
+	}
+	return current, common.ValidateKubernetesUpgrade(current, op.UpgradeConfig.KubernetesVersion)
+}
+
+func (m *upgradeServiceImpl) UpgradeControlPlane(ctx context.Context, op common.KubeVirtUpgradeOperation) error {
+	kc, err := common.GetHubClient(op.KubeVirtCredential.KubeConfig)
+	if err != nil {
+		return err
+	}
+	cp, err := common.GetControlPlane(ctx, kc, clusterKey(op))
+	if err != nil {
+		return err
+	}
+	return common.UpgradeControlPlane(ctx, kc, cp, op.UpgradeConfig.KubernetesVersion)
+}
+
+// CheckControlPlaneUpgraded reports whether the control plane finished its rollout to the target version, the
+// template it replaced is deleted once it did
+func (m *upgradeServiceImpl) CheckControlPlaneUpgraded(ctx context.Context, op common.KubeVirtUpgradeOperation) (bool, error) {
+	kc, err := common.GetHubClient(op.KubeVirtCredential.KubeConfig)
+	if err != nil {
+		return false, err
+	}
+	cp, err := common.GetControlPlane(ctx, kc, clusterKey(op))
+	if err != nil {
+		return false, err
+	}
+	if !common.IsControlPlaneUpgraded(cp, op.UpgradeConfig.KubernetesVersion) {
+		return false, nil
+	}
+	return true, common.DeleteUnusedControlPlaneTemplates(ctx, kc, cp)
+}
+
+func (m *upgradeServiceImpl) NextMachineDeploymentToUpgrade(ctx context.Context, op common.KubeVirtUpgradeOperation) (string, error) {
+	kc, err := common.GetHubClient(op.KubeVirtCredential.KubeConfig)
+	if err != nil {
+		return "", err
+	}
+	return common.NextMachineDeploymentToUpgrade(ctx, kc, clusterKey(op), op.UpgradeConfig.KubernetesVersion)
+}
+
+func (m *upgradeServiceImpl) UpgradeMachineDeployment(ctx context.Context, op common.KubeVirtUpgradeOperation, name string) error {
+	kc, err := common.GetHubClient(op.KubeVirtCredential.KubeConfig)
+	if err != nil {
+		return err
+	}
+	return common.UpgradeMachineDeployment(ctx, kc, types.NamespacedName{Namespace: op.UpgradeConfig.InfraNamespace, Name: name}, op.UpgradeConfig.KubernetesVersion)
+}
+
+// CheckMachineDeploymentReady reports whether the machines of a worker pool finished their rollout, the templates
+// they replaced are deleted once they did
+func (m *upgradeServiceImpl) CheckMachineDeploymentReady(ctx context.Context, op common.KubeVirtUpgradeOperation, name string) (bool, error) {
+	kc, err := common.GetHubClient(op.KubeVirtCredential.KubeConfig)
+	if err != nil {
+		return false, err
+	}
+	key := types.NamespacedName{Namespace: op.UpgradeConfig.InfraNamespace, Name: name}
+	ready, err := common.IsMachineDeploymentReady(ctx, kc, key)
+	if err != nil || !ready {
+		return false, err
+	}
+	return true, common.DeleteUnusedMachineTemplates(ctx, kc, key)
+}
+
+// PauseRollout pauses or resumes the reconciliation of the cluster, and with it the rollout of its machines
+func (m *upgradeServiceImpl) PauseRollout(ctx context.Context, op common.KubeVirtUpgradeOperation, paused bool) error {
+	kc, err := common.GetHubClient(op.KubeVirtCredential.KubeConfig)
+	if err != nil {
+		return err
+	}
+	return common.PauseCluster(ctx, kc, clusterKey(op), paused)
+}
+
+func NewClusterUpgradeService() ClusterUpgradeService {
+	return &upgradeServiceImpl{}
+}
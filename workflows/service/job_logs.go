@@ -0,0 +1,240 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/internal/persistence"
+)
+
+const (
+	logFlushInterval = 2 * time.Second
+	logBatchSize     = 50
+	// logDrainTimeout bounds how long WaitForJobLogs waits for the last lines of a finished pod
+	logDrainTimeout = 30 * time.Second
+)
+
+// logLinePattern matches the lines written by the log() function of the scripts: `timestamp [script] [TYPE] msg`
+var logLinePattern = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[([^\]]+)\] \[([A-Z]+)\] (.*)$`)
+
+// ParseLogLine splits a line of capi-runner output into its log() fields, other output is kept as the message
+func ParseLogLine(line string) persistence.LogLine {
+	m := logLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return persistence.LogLine{Message: line}
+	}
+	return persistence.LogLine{Time: m[1], Script: m[2], Level: m[3], Message: m[4]}
+}
+
+// LogTailer copies the output of capi-runner pods into the history store, at most one copy per workflow at a time.
+// The create and delete services share one, Stop ends its copies when the worker shuts down.
+type LogTailer struct {
+	k8sClient client.Client
+	clientset kubernetes.Interface
+
+	// ctx is the parent of every copy, Stop cancels it
+	ctx    context.Context
+	cancel context.CancelFunc
+	copies sync.WaitGroup
+
+	mu     sync.Mutex
+	active map[string]chan struct{}
+}
+
+// NewLogTailer returns a LogTailer that reads the pods with clientset, a nil clientset turns it off
+func NewLogTailer(k8sClient client.Client, clientset kubernetes.Interface) *LogTailer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LogTailer{
+		k8sClient: k8sClient,
+		clientset: clientset,
+		ctx:       ctx,
+		cancel:    cancel,
+		active:    map[string]chan struct{}{},
+	}
+}
+
+// Stop cancels the running copies and returns once each of them stored the lines it had read. A copy gets
+// logDrainTimeout for that, so Stop returns within about that long.
+func (t *LogTailer) Stop() {
+	if t == nil {
+		return
+	}
+	t.cancel()
+	t.copies.Wait()
+}
+
+// StreamJobLogs starts following the capi-runner pod in namespace in the background. Lines already stored for
+// the workflow are skipped by their line number, so calling it again after a worker restart continues where the
+// last copy stopped. Two workers may copy the same pod at once, GetLogs returns the lines both stored once.
+func (t *LogTailer) StreamJobLogs(workflowID, namespace string) {
+	if t == nil || t.clientset == nil {
+		return
+	}
+	t.mu.Lock()
+	if _, ok := t.active[workflowID]; ok {
+		t.mu.Unlock()
+		return
+	}
+	done := make(chan struct{})
+	t.active[workflowID] = done
+	t.copies.Add(1)
+	t.mu.Unlock()
+
+	go func() {
+		defer t.copies.Done()
+		defer func() {
+			t.mu.Lock()
+			delete(t.active, workflowID)
+			t.mu.Unlock()
+			close(done)
+		}()
+		if err := t.follow(workflowID, namespace); err != nil {
+			log.Printf("failed to stream capi-runner logs of workflow %s: %v", workflowID, err)
+		}
+	}()
+}
+
+// WaitForJobLogs waits until the copy started by StreamJobLogs for the workflow has stored the last lines of
+// the pod. The log stream ends once the container exits, so it returns quickly after the Job finished.
+func (t *LogTailer) WaitForJobLogs(workflowID string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	done, ok := t.active[workflowID]
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(logDrainTimeout):
+		log.Printf("capi-runner logs of workflow %s were not stored within %s", workflowID, logDrainTimeout)
+	}
+}
+
+func (t *LogTailer) follow(workflowID, namespace string) error {
+	ctx, cancel := context.WithTimeout(t.ctx, RetryTimeout)
+	defer cancel()
+
+	podName, err := t.waitForRunnerPod(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	stored, err := persistence.GetLogs(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+	// only this pod's lines are skipped, the lines of a replaced Job's pod stay as they are. The highest number
+	// stored counts, the older lines may have been trimmed by the store.
+	skip := 0
+	for _, line := range stored {
+		if line.Pod == podName && line.Line > skip {
+			skip = line.Line
+		}
+	}
+
+	stream, err := t.clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{Follow: true}).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stream)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var batch []persistence.LogLine
+	flush := func(ctx context.Context) error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := persistence.AppendLogs(ctx, workflowID, batch)
+		batch = nil
+		return err
+	}
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+	number := 0
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return flush(ctx)
+			}
+			number++
+			if number <= skip {
+				continue
+			}
+			parsed := ParseLogLine(line)
+			parsed.Pod, parsed.Line = podName, number
+			batch = append(batch, parsed)
+			if len(batch) >= logBatchSize {
+				if err := flush(ctx); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := flush(ctx); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			// ctx is already over, the lines read so far are stored with a context of their own
+			flushCtx, cancel := context.WithTimeout(context.Background(), logDrainTimeout)
+			defer cancel()
+			return flush(flushCtx)
+		}
+	}
+}
+
+// waitForRunnerPod returns the pod of the current capi-runner Job of namespace once its container has started. The
+// pod of a replaced Job may still be there while it is removed, so only pods the current Job controls count.
+func (t *LogTailer) waitForRunnerPod(ctx context.Context, namespace string) (string, error) {
+	var podName string
+	err := wait.PollUntilContextCancel(ctx, RetryInterval, true, func(ctx context.Context) (bool, error) {
+		job := &batchv1.Job{}
+		err := t.k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: CAPIRunnerJobName}, job)
+		if k8serrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		pods := &corev1.PodList{}
+		err = t.k8sClient.List(ctx, pods, client.InNamespace(namespace), client.MatchingLabels{"job-name": CAPIRunnerJobName})
+		if err != nil {
+			return false, err
+		}
+		for _, pod := range pods.Items {
+			if metav1.IsControlledBy(&pod, job) && pod.Status.Phase != corev1.PodPending {
+				podName = pod.Name
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return podName, err
+}
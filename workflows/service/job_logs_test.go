@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func runnerPod(name string, jobUID types.UID, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "demo-abc123",
+			Labels:    map[string]string{"job-name": CAPIRunnerJobName},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "batch/v1",
+				Kind:       "Job",
+				Name:       CAPIRunnerJobName,
+				UID:        jobUID,
+				Controller: ptr.To(true),
+			}},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestWaitForRunnerPod(t *testing.T) {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: CAPIRunnerJobName, Namespace: "demo-abc123", UID: "current"}}
+	tests := []struct {
+		name    string
+		objects []client.Object
+		want    string
+	}{
+		{
+			name:    "pod of the current job",
+			objects: []client.Object{job, runnerPod("capi-runner-2", "current", corev1.PodRunning)},
+			want:    "capi-runner-2",
+		},
+		{
+			name: "failed pod of a replaced job",
+			objects: []client.Object{
+				job,
+				runnerPod("capi-runner-1", "replaced", corev1.PodFailed),
+				runnerPod("capi-runner-2", "current", corev1.PodRunning),
+			},
+			want: "capi-runner-2",
+		},
+		{
+			name:    "only a replaced job's pod",
+			objects: []client.Object{job, runnerPod("capi-runner-1", "replaced", corev1.PodFailed)},
+		},
+		{
+			name:    "pending pod",
+			objects: []client.Object{job, runnerPod("capi-runner-2", "current", corev1.PodPending)},
+		},
+		{
+			name:    "no job",
+			objects: []client.Object{runnerPod("capi-runner-1", "replaced", corev1.PodFailed)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tailer := NewLogTailer(fake.NewClientBuilder().WithObjects(tt.objects...).Build(), nil)
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			got, err := tailer.waitForRunnerPod(ctx, "demo-abc123")
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("waitForRunnerPod() = %q, want no pod until the deadline", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("waitForRunnerPod() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
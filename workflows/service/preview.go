@@ -0,0 +1,53 @@
+package service
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/RejwankabirHamim/cadence-iwf-poc/pkg/common"
+	"github.com/pkg/errors"
+)
+
+// RedactedValue replaces secrets in a CreatePreview
+const RedactedValue = "<redacted>"
+
+// previewNamespaceSuffix stands in for the random suffix of the runner namespace, so a preview only depends on
+// the request and previews of the same request are equal
+const previewNamespaceSuffix = "xxxxxx"
+
+// CreatePreview is what creating a cluster would run on the hub, with secrets redacted
+type CreatePreview struct {
+	Namespace string       `json:"namespace"`
+	Image     string       `json:"image"`
+	Script    string       `json:"script"`
+	Job       *batchv1.Job `json:"job"`
+}
+
+// PreviewCreate renders the script and Job of a cluster creation the same way CreateNamespace and CreateJob do,
+// without talking to the hub. The admin kubeconfig is replaced by RedactedValue, and the namespace gets a fixed
+// placeholder suffix where a real run picks a random one.
+func PreviewCreate(op common.KubeVirtCreateOperation, images common.RunnerImages) (*CreatePreview, error) {
+	if op.CAPIConfig == nil {
+		return nil, errors.New("cluster config is required")
+	}
+	op.KubeVirtCredential = &common.KubeVirtCredential{KubeConfig: RedactedValue}
+
+	namespace := common.RunnerNamespaceNameWithSuffix(op.CAPIConfig.ClusterName, previewNamespaceSuffix)
+	script, err := op.RenderScript(namespace)
+	if err != nil {
+		return nil, err
+	}
+	imgName, err := op.GetBaseImage(images)
+	if err != nil {
+		return nil, err
+	}
+
+	job := newCAPIRunnerJob(namespace, op.CAPIConfig.ClusterName, namespace, imgName, images.PullSecrets)
+	job.TypeMeta = metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"}
+	return &CreatePreview{
+		Namespace: namespace,
+		Image:     imgName,
+		Script:    string(script),
+		Job:       job,
+	}, nil
+}